@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ftb-server-downloader/modloaders"
+	"ftb-server-downloader/structs"
+	"ftb-server-downloader/util"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// bundleModloaderDir is where the output of the modloader installer goes in a bundle
+const bundleModloaderDir = "modloader"
+
+var (
+	bundleOsList   = []string{"linux", "windows", "darwin"}
+	bundleArchList = []string{"amd64", "arm64", "386", "arm"}
+
+	// activeBundle is the bundle given with -bundle, every request is answered from it
+	activeBundle  *util.Bundle
+	bundleWorkDir string
+)
+
+func runBundleCommand(args []string) {
+	if len(args) == 0 || args[0] != "create" {
+		fail(util.ExitUsage, "Usage: bundle create -out <file>")
+	}
+	runBundleCreate()
+}
+
+// runBundleCreate downloads everything an install of the pack needs and writes it to a single file. Every
+// response is recorded, not just the files, so an install from the bundle goes through exactly the same steps
+// as an online install.
+func runBundleCreate() {
+	if bundleOut == "" {
+		fail(util.ExitUsage, "bundle create requires the -out flag")
+	}
+	if !slices.Contains(bundleOsList, bundleOs) {
+		fail(util.ExitUsage, fmt.Sprintf("Unknown os '%s', valid values are %v", bundleOs, bundleOsList))
+	}
+	if !slices.Contains(bundleArchList, bundleArch) {
+		fail(util.ExitUsage, fmt.Sprintf("Unknown arch '%s', valid values are %v", bundleArch, bundleArchList))
+	}
+	out, err := filepath.Abs(bundleOut)
+	if err != nil {
+		fail(util.ExitError, "Error getting absolute path:", err.Error())
+	}
+
+	bundleWorkDir, err = os.MkdirTemp("", "ftb-bundle-*")
+	if err != nil {
+		fail(util.ExitError, "Error creating temp directory:", err.Error())
+	}
+	defer cleanupBundle()
+	contentDir := filepath.Join(bundleWorkDir, "bundle")
+	filesDir := filepath.Join(bundleWorkDir, "files")
+
+	recorder, err := util.NewResponseRecorder(contentDir)
+	if err != nil {
+		fail(util.ExitError, err.Error())
+	}
+	opts := httpOptions()
+	opts.Record = recorder
+	if err = util.SetHTTPOptions(opts); err != nil {
+		fail(util.ExitUsage, "Error setting up HTTP client:", err.Error())
+	}
+	// A cache hit never reaches the recorder
+	downloadCache = nil
+
+	setPackFromInstallerName()
+	selectedProvider := mustGetProvider()
+	modpack, modpackVersion, err := resolvePack(selectedProvider)
+	if err != nil {
+		fail(util.ExitResolveFailed, err.Error())
+	}
+	defer cleanupPackArchive()
+
+	manifest := structs.BundleManifest{
+		Format:           util.BundleFormat,
+		Created:          time.Now().UTC(),
+		InstallerVersion: util.ReleaseVersion,
+		Os:               bundleOs,
+		Arch:             bundleArch,
+		Provider:         provider,
+		PackId:           packId,
+		VersionId:        versionId,
+		Project:          project,
+		ProjectVersion:   projectVer,
+		Latest:           latest,
+		Name:             modpack.Name,
+		VersionName:      modpackVersion.Name,
+	}
+	if provider == "local" {
+		manifest.Source = filepath.Join("source", filepath.Base(source))
+		if err = copySource(source, filepath.Join(contentDir, manifest.Source)); err != nil {
+			fail(util.ExitError, "Error adding source to bundle:", err.Error())
+		}
+	}
+
+	files := append([]structs.File{}, modpackVersion.Files...)
+
+	modloaderDir := filepath.Join(contentDir, bundleModloaderDir)
+	modLoader, err := getModLoader(modpackVersion.Targets, modpackVersion.Memory, modloaderDir)
+	if err != nil {
+		fail(util.ExitResolveFailed, "Error getting modloader:", err.Error())
+	}
+	mlDownloads, err := modLoader.GetDownload()
+	if err != nil {
+		fail(util.ExitResolveFailed, "Error getting mod loader downloads:", err.Error())
+	}
+	// The java installers download their libraries while they run, so they're run now and their output is
+	// bundled instead of the installer
+	prebuilder, prebuild := modLoader.(modloaders.Prebuilder)
+	prebuild = prebuild && modLoader.RequiresJava() && !skipModloader
+	if !prebuild {
+		files = append(files, mlDownloads...)
+	}
+	manifest.SkipModloader = skipModloader
+	if fabricLaunch {
+		manifest.FabricLauncher = fabricLaunchHash
+	}
+
+	// The modloaders fetch the vanilla jar and log4j patches while installing
+	if vanilla, err := modloaders.GetVanilla(modpackVersion.Targets, filesDir); err != nil {
+		pterm.Warning.Println("Unable to add the vanilla server jar to the bundle:", err.Error())
+	} else if vanillaDl, err := vanilla.GetDownload(); err != nil {
+		pterm.Warning.Println("Unable to add the vanilla server jar to the bundle:", err.Error())
+	} else {
+		files = append(files, vanillaDl...)
+	}
+	if err = os.MkdirAll(filesDir, 0755); err != nil {
+		fail(util.ExitError, err.Error())
+	}
+	if _, err = modloaders.Log4JFixer(filesDir, modpackVersion.Targets.McVersion); err != nil {
+		pterm.Warning.Println("Unable to add the log4j patches to the bundle:", err.Error())
+	}
+
+	if !noJava {
+		java, err := getJavaFor(modpackVersion.Targets.JavaVersion, bundleOs, bundleArch)
+		if err != nil {
+			fail(util.ExitResolveFailed, "Error getting java:", err.Error())
+		}
+		manifest.Java = &java
+		files = append(files, java)
+	}
+
+	pterm.Info.Printfln("Bundling %s %s for %s/%s", modpack.Name, modpackVersion.Name, bundleOs, bundleArch)
+	downloadCtx, stopDownloads := signal.NotifyContext(context.Background(), os.Interrupt)
+	err = downloadFiles(downloadCtx, filesDir, files...)
+	stopDownloads()
+	if err != nil {
+		fail(util.ExitDownloadFailed, err.Error())
+	}
+	_ = os.RemoveAll(filesDir)
+
+	if prebuild {
+		if err = prebuildModLoader(prebuilder, modloaderDir, modpackVersion.Targets.JavaVersion, mlDownloads, opts); err != nil {
+			fail(util.ExitModloaderFailed, "Error running the modloader installer for the bundle:", err.Error())
+		}
+		manifest.Modloader = bundleModloaderDir
+	}
+
+	manifest.Responses = recorder.Responses()
+	pterm.Info.Printfln("Writing %d responses to %s", len(manifest.Responses), out)
+	if err = util.WriteBundle(out, contentDir, manifest); err != nil {
+		fail(util.ExitError, "Error writing bundle:", err.Error())
+	}
+	if info, err := os.Stat(out); err == nil {
+		pterm.Success.Printfln("Bundle written to %s (%s)", out, util.FormatBytes(info.Size()))
+	}
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
+
+// useBundle extracts the -bundle file and answers every request from it from now on, the pack and version
+// are the ones the bundle was made with
+func useBundle() {
+	var err error
+	bundleWorkDir, err = os.MkdirTemp("", "ftb-bundle-*")
+	if err != nil {
+		fail(util.ExitError, "Error creating temp directory:", err.Error())
+	}
+	pterm.Info.Printfln("Extracting bundle %s", bundlePath)
+	activeBundle, err = util.OpenBundle(bundlePath, bundleWorkDir)
+	if err != nil {
+		fail(util.ExitUsage, "Error opening bundle:", err.Error())
+	}
+
+	m := activeBundle.Manifest
+	if m.Java != nil && !noJava && (m.Os != runtime.GOOS || m.Arch != runtime.GOARCH) {
+		fail(util.ExitUsage, fmt.Sprintf("The bundle was made for %s/%s but this is %s/%s, use -no-java to install it without the bundled java", m.Os, m.Arch, runtime.GOOS, runtime.GOARCH))
+	}
+	opts := httpOptions()
+	opts.Replay = activeBundle
+	if err = util.SetHTTPOptions(opts); err != nil {
+		fail(util.ExitUsage, "Error setting up HTTP client:", err.Error())
+	}
+
+	provider = m.Provider
+	packId = m.PackId
+	versionId = m.VersionId
+	project = m.Project
+	projectVer = m.ProjectVersion
+	latest = m.Latest
+	if m.Source != "" {
+		source = filepath.Join(activeBundle.Dir, m.Source)
+	}
+	if m.SkipModloader && !skipModloader {
+		pterm.Info.Println("The bundle was made with -skip-modloader, the modloader has to be installed separately")
+		skipModloader = true
+	}
+	if m.FabricLauncher != "" {
+		if !fabricLaunch {
+			pterm.Info.Println("The bundle was made with -fabric-launcher, using Fabric's prebuilt server launcher")
+		}
+		fabricLaunch = true
+		fabricLaunchHash = m.FabricLauncher
+	}
+	pterm.Info.Printfln("Installing %s %s from a bundle made %s", m.Name, m.VersionName, m.Created.Format(time.RFC1123))
+}
+
+// bundledModLoader reports if the modloader is installed from the installer output in the -bundle
+func bundledModLoader() bool {
+	return activeBundle != nil && activeBundle.Manifest.Modloader != ""
+}
+
+// installModLoader runs the modloader installer, or with a bundle copies in the output it had when the bundle
+// was made and only writes the start scripts
+func installModLoader(modLoader modloaders.ModLoader, javaPath string) error {
+	if !bundledModLoader() {
+		return modLoader.Install(javaPath)
+	}
+	prebuilt, ok := modLoader.(modloaders.Prebuilder)
+	if !ok {
+		return fmt.Errorf("the bundle has installer output for %s, which can't use it", activeBundle.Manifest.Name)
+	}
+	src, err := util.SafeJoin(activeBundle.Dir, activeBundle.Manifest.Modloader)
+	if err != nil {
+		return err
+	}
+	pterm.Info.Println("Installing the modloader from the bundle")
+	if err = util.CopyFS(os.DirFS(src), ".", installDir); err != nil {
+		return fmt.Errorf("error copying the modloader from the bundle: %s", err.Error())
+	}
+	return prebuilt.StartScript(javaPath)
+}
+
+// prebuildModLoader downloads the modloader installer into dir and runs it there with a java for this machine
+func prebuildModLoader(modLoader modloaders.Prebuilder, dir string, javaVersion string, downloads []structs.File, opts util.HTTPOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := downloadFiles(ctx, dir, downloads...); err != nil {
+		return err
+	}
+	javaPath, err := hostJava(ctx, javaVersion, opts)
+	if err != nil {
+		return err
+	}
+	return modLoader.RunInstaller(javaPath)
+}
+
+// hostJava finds a java on this machine to run the modloader installer with, downloading one if none is
+// installed. The download isn't recorded, the bundle has its own java for -os/-arch.
+func hostJava(ctx context.Context, version string, opts util.HTTPOptions) (string, error) {
+	if systemJava, ok := util.FindJava(version); ok {
+		return systemJava.Path, nil
+	}
+	store, err := util.NewRuntimeStore(filepath.Join(bundleWorkDir, "java"))
+	if err != nil {
+		return "", err
+	}
+	name := util.RuntimeName(javaProvider, version, runtime.GOARCH)
+
+	recordOpts := opts
+	opts.Record = nil
+	if err = util.SetHTTPOptions(opts); err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = util.SetHTTPOptions(recordOpts)
+	}()
+	pterm.Info.Printfln("No java %s installed, downloading it to run the modloader installer", version)
+	java, err := getJavaFor(version, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	if err = downloadFiles(ctx, store.Dir, java); err != nil {
+		return "", err
+	}
+	if err = store.Add(name, filepath.Join(store.Dir, java.Name)); err != nil {
+		return "", fmt.Errorf("error extracting java: %s", err.Error())
+	}
+	return store.JavaPath(name)
+}
+
+func cleanupBundle() {
+	if bundleWorkDir == "" {
+		return
+	}
+	if err := os.RemoveAll(bundleWorkDir); err != nil {
+		pterm.Warning.Printfln("Unable to remove %s: %s", bundleWorkDir, err.Error())
+	}
+	bundleWorkDir = ""
+}
+
+// getJava gets the JRE to download from the -java-provider, an install from a bundle uses the one the
+// bundle was made with
+func getJava(version string) (structs.File, error) {
+	if activeBundle == nil {
+		return getJavaFor(version, runtime.GOOS, runtime.GOARCH)
+	}
+	if activeBundle.Manifest.Java == nil {
+		return structs.File{}, errors.New("the bundle doesn't include java, use -no-java")
+	}
+	return *activeBundle.Manifest.Java, nil
+}
+
+func getJavaFor(version string, goos string, goarch string) (structs.File, error) {
+	javaSource, err := util.GetJavaProvider(javaProvider)
+	if err != nil {
+		return structs.File{}, err
+	}
+	pterm.Debug.Printfln("Getting java %s for %s/%s from %s", version, goos, goarch, javaProvider)
+	return javaSource.GetJava(version, goos, goarch)
+}
+
+// copySource copies the local provider's source file or directory into the bundle
+func copySource(src string, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return util.CopyFS(os.DirFS(src), ".", dst)
+	}
+	return util.CopyFile(src, dst)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"ftb-server-downloader/util"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// commands are the subcommands the installer understands, install is used when none is given
+var commands = []string{"install", "update", "verify", "repair", "info", "uninstall", "cache", "runtimes", "rollback", "config", "bundle", "self-update"}
+
+// offlineCommands only work on what's already on disk and never go online
+var offlineCommands = []string{"verify", "uninstall", "rollback", "cache", "runtimes", "config"}
+
+// parseArgs parses the flags wherever they are in args, returning the other arguments in order
+func parseArgs(args []string) []string {
+	var positional []string
+	for {
+		_ = flag.CommandLine.Parse(args)
+		args = flag.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	_, _ = fmt.Fprintf(out, "Usage: %s [command] [flags]\n\n", filepath.Base(os.Args[0]))
+	_, _ = fmt.Fprintln(out, "Commands:")
+	_, _ = fmt.Fprintln(out, "  install    Install the modpack (default)")
+	_, _ = fmt.Fprintln(out, "  update     Update the modpack installed in -dir")
+	_, _ = fmt.Fprintln(out, "  verify     Check the installed files against the install manifest")
+	_, _ = fmt.Fprintln(out, "  repair     Download any installed files that fail verification")
+	_, _ = fmt.Fprintln(out, "  info       Show the modpack and version details without installing anything")
+	_, _ = fmt.Fprintln(out, "  uninstall  Remove every file installed from the modpack")
+	_, _ = fmt.Fprintln(out, "  rollback   Restore the version installed before the last update")
+	_, _ = fmt.Fprintln(out, "  cache      Manage the download cache (cache prune)")
+	_, _ = fmt.Fprintln(out, "  runtimes   Manage the shared java runtimes (runtimes gc)")
+	_, _ = fmt.Fprintln(out, "  bundle     Download everything needed to install the modpack offline into one file (bundle create -out <file>)")
+	_, _ = fmt.Fprintln(out, "  self-update Update the installer to the newest version on -update-channel, or to -installer-version")
+	_, _ = fmt.Fprintln(out, "  config     Show the config after merging flags, environment variables and the config file (config dump)")
+	_, _ = fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// readInstalledManifest reads the manifest of the modpack installed in installDir
+func readInstalledManifest() (structs.Manifest, error) {
+	exists, err := util.PathExists(filepath.Join(installDir, util.ManifestName))
+	if err != nil {
+		return structs.Manifest{}, err
+	}
+	if !exists {
+		return structs.Manifest{}, fmt.Errorf("no modpack is installed in %s", installDir)
+	}
+	return util.ReadManifest(installDir)
+}
+
+func runInfo() {
+	setPackFromInstallerName()
+	selectedProvider := mustGetProvider()
+	modpack, modpackVersion, err := resolvePack(selectedProvider)
+	if err != nil {
+		fail(util.ExitResolveFailed, err.Error())
+	}
+	defer cleanupPackArchive()
+
+	var totalSize int64
+	for _, f := range modpackVersion.Files {
+		totalSize += f.Size
+	}
+	pterm.Info.Printfln("Name: %s (%d)\nVersion: %s (%d)\nMinecraft: %s\nModLoader: %s (%s)\nJava: %s\nMemory: %d MB minimum, %d MB recommended\nFiles: %d (%s)",
+		modpack.Name, modpack.Id,
+		modpackVersion.Name, modpackVersion.Id,
+		modpackVersion.Targets.McVersion,
+		modpackVersion.Targets.ModLoader.Name, modpackVersion.Targets.ModLoader.Version,
+		modpackVersion.Targets.JavaVersion,
+		modpackVersion.Memory.Minimum, modpackVersion.Memory.Recommended,
+		len(modpackVersion.Files), util.FormatBytes(totalSize),
+	)
+
+	if len(modpack.Versions) > 0 {
+		var versions []string
+		for i, v := range modpack.Versions {
+			if i == 10 {
+				versions = append(versions, fmt.Sprintf("... and %d more", len(modpack.Versions)-i))
+				break
+			}
+			versions = append(versions, fmt.Sprintf("%d (%s)", v.Id, v.Type))
+		}
+		pterm.Info.Printfln("Available versions:\n%s", strings.Join(versions, "\n"))
+	}
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
+
+// runVerify checks the install against its manifest without going online, any missing, modified or
+// untracked file is drift and exits with util.ExitValidationFailed
+func runVerify() {
+	manifest, err := readInstalledManifest()
+	if err != nil {
+		fail(util.ExitUsage, err.Error())
+	}
+
+	report, result, err := checkFiles(manifest)
+	if err != nil {
+		fail(util.ExitError, "Error verifying files:", err.Error())
+	}
+	util.Emit(util.EventValidation, result)
+	if report.HasDrift() {
+		fail(util.ExitValidationFailed, fmt.Sprintf("%s version %s has drifted from its manifest: %d missing, %d modified, %d untracked files", manifest.Name, manifest.VersionName, len(result.Missing), len(result.Modified), len(result.Extra)))
+	}
+	pterm.Success.Printfln("All %d files verified", result.Checked)
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
+
+func runRepair() {
+	manifest, err := readInstalledManifest()
+	if err != nil {
+		fail(util.ExitUsage, err.Error())
+	}
+
+	report, result, err := checkFiles(manifest)
+	if err != nil {
+		fail(util.ExitError, "Error verifying files:", err.Error())
+	}
+	invalidFiles := report.Invalid()
+	if len(invalidFiles) == 0 {
+		util.Emit(util.EventValidation, result)
+		pterm.Success.Printfln("All %d files verified, nothing to repair", result.Checked)
+		util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+		return
+	}
+
+	downloads := repairableFiles(invalidFiles)
+	pterm.Info.Printfln("Repairing %d files", len(downloads))
+	err = downloadFiles(context.Background(), installDir, downloads...)
+	if err != nil {
+		util.Emit(util.EventValidation, result)
+		fail(util.ExitDownloadFailed, err.Error())
+	}
+	result.Repaired = len(downloads) == len(invalidFiles)
+	util.Emit(util.EventValidation, result)
+	if !result.Repaired {
+		fail(util.ExitValidationFailed, fmt.Sprintf("Repaired %d files, %d override files could not be repaired", len(downloads), len(invalidFiles)-len(downloads)))
+	}
+	pterm.Success.Printfln("Repaired %d files", len(downloads))
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
+
+func runUninstall() {
+	manifest, err := readInstalledManifest()
+	if err != nil {
+		fail(util.ExitUsage, err.Error())
+	}
+
+	if !auto {
+		cont := util.ConfirmYN(fmt.Sprintf("Remove %s version %s from %s?", manifest.Name, manifest.VersionName, installDir), false, pterm.Warning.MessageStyle)
+		if !cont {
+			fail(util.ExitAborted, "Uninstall cancelled")
+		}
+	}
+
+	removed := 0
+	dirs := make(map[string]struct{})
+	for _, f := range manifest.Files {
+		path, err := util.SafeJoin(installDir, f.Path, f.Name)
+		if err != nil {
+			pterm.Error.Println(err.Error())
+			continue
+		}
+		err = os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			pterm.Error.Printfln("Error removing %s: %s", filepath.Join(f.Path, f.Name), err.Error())
+			continue
+		}
+		if err == nil {
+			removed++
+		}
+		if f.Path != "" {
+			dirs[filepath.Dir(path)] = struct{}{}
+		}
+	}
+
+	// Clean up the folders the pack created, anything left in them (worlds, logs etc.) keeps them around
+	var sortedDirs []string
+	for dir := range dirs {
+		sortedDirs = append(sortedDirs, dir)
+	}
+	slices.SortFunc(sortedDirs, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	for _, dir := range sortedDirs {
+		for d := dir; d != installDir && strings.HasPrefix(d, installDir); d = filepath.Dir(d) {
+			if empty, err := util.IsEmptyDir(d); err != nil || !empty {
+				break
+			}
+			_ = os.Remove(d)
+		}
+	}
+
+	for _, name := range []string{util.StagingDirName, util.BackupDirName, util.OriginalsDirName} {
+		if err = os.RemoveAll(filepath.Join(installDir, name)); err != nil {
+			pterm.Warning.Printfln("Unable to remove %s: %s", name, err.Error())
+		}
+	}
+	if err = os.Remove(filepath.Join(installDir, util.ManifestName)); err != nil {
+		fail(util.ExitInstallFailed, "Error removing manifest:", err.Error())
+	}
+
+	pterm.Success.Printfln("Removed %d files from %s", removed, installDir)
+	pterm.Info.Println("Files that weren't part of the modpack, like worlds, java and the modloader, have been left in place")
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
+
+func runCacheCommand(args []string) {
+	if downloadCache == nil {
+		fail(util.ExitUsage, "No cache directory set, use -cache-dir or FTB_INSTALLER_CACHE_DIR")
+	}
+	if len(args) == 0 || args[0] != "prune" {
+		fail(util.ExitUsage, "Usage: cache prune")
+	}
+	pruneCache()
+	pterm.Success.Println("Download cache pruned")
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
+
+func runRuntimesCommand(args []string) {
+	if runtimeStore == nil {
+		fail(util.ExitUsage, "No runtime directory set, use -runtime-dir or FTB_INSTALLER_RUNTIME_DIR")
+	}
+	if len(args) == 0 || args[0] != "gc" {
+		fail(util.ExitUsage, "Usage: runtimes gc")
+	}
+	removed, err := runtimeStore.GC()
+	for _, name := range removed {
+		pterm.Info.Printfln("Removed runtime %s", name)
+	}
+	if err != nil {
+		fail(util.ExitError, "Error removing unused runtimes:", err.Error())
+	}
+	pterm.Success.Printfln("Removed %d unused runtimes", len(removed))
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
+
+// restoreRuntime references the shared runtime the rolled back manifest uses again, so gc keeps it
+func restoreRuntime(name string) {
+	if err := runtimeStore.AddReference(name, installDir); err != nil {
+		pterm.Warning.Printfln("Unable to reference java runtime %s, runtimes gc may remove it: %s", name, err.Error())
+	}
+	if has, err := runtimeStore.Has(name); err != nil || !has {
+		pterm.Warning.Printfln("Java runtime %s is no longer in %s, rerun the installer for this version to download it again", name, runtimeStore.Dir)
+	}
+}
+
+func runRollback() {
+	hasBackup, err := util.HasBackup(installDir)
+	if err != nil {
+		fail(util.ExitError, "Error checking for backup:", err.Error())
+	}
+	if !hasBackup {
+		fail(util.ExitUsage, fmt.Sprintf("No previous version found to roll back to in %s", installDir))
+	}
+
+	if !auto {
+		backupManifest, err := util.ReadManifest(filepath.Join(installDir, util.BackupDirName))
+		if err != nil {
+			fail(util.ExitError, "Error reading backup manifest:", err.Error())
+		}
+		cont := util.ConfirmYN(fmt.Sprintf("Roll back to %s version %s?", backupManifest.Name, backupManifest.VersionName), true, pterm.Info.MessageStyle)
+		if !cont {
+			fail(util.ExitAborted, "Rollback cancelled")
+		}
+	}
+
+	restored, err := util.Rollback(installDir)
+	if err != nil {
+		fail(util.ExitInstallFailed, "Error rolling back:", err.Error())
+	}
+	if runtimeStore != nil && restored.Runtime != "" {
+		restoreRuntime(restored.Runtime)
+	}
+	pterm.Success.Printfln("Rolled back to %s version %s", restored.Name, restored.VersionName)
+	pterm.Info.Println("Modloader files are not rolled back, if the modloader version changed rerun the installer for this version")
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"ftb-server-downloader/util"
+	"os"
+
+	"github.com/pterm/pterm"
+)
+
+var (
+	configPath     string
+	memoryOverride structs.ConfigMemory
+	exclude        []string
+)
+
+// loadConfig reads the config file given with -config, or the ftb-installer.json next to the installer, and
+// fills in every flag that wasn't set on the command line or by an environment variable
+func loadConfig() error {
+	if configPath == "" {
+		configPath = util.FindConfig()
+		if configPath == "" {
+			return nil
+		}
+	}
+	config, err := util.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	pterm.Debug.Printfln("Loaded config from %s", configPath)
+
+	setString(config.Provider, &provider, "provider", "")
+	setInt(config.Pack, &packId, "pack")
+	setInt(config.Version, &versionId, "version")
+	setString(config.Project, &project, "project", "")
+	setString(config.ProjectVersion, &projectVer, "project-version", "")
+	setString(config.Source, &source, "source", "")
+	setString(config.Dir, &installDir, "dir", "")
+	setInt(config.Threads, &threads, "threads")
+	setInt(config.Timeout, &dlTimeout, "timeout")
+	setInt(config.ConnectTimeout, &dialTimeout, "connect-timeout")
+	setString(config.Proxy, &proxy, "proxy", "HTTPS_PROXY")
+	setString(config.CACert, &caCert, "ca-cert", "")
+	// Mirrors from the config file are added to the -mirror flags, a flag wins if both rewrite the same URL
+	for from, to := range config.Mirrors {
+		if _, ok := mirrors[from]; !ok {
+			mirrors[from] = to
+		}
+	}
+	setString(config.ApiKey, &apiKey, "apikey", "FTB_MODPACK_API_KEY")
+	setBool(config.Auto, &auto, "auto")
+	setBool(config.Force, &force, "force")
+	setBool(config.Validate, &validate, "validate")
+	setBool(config.SkipModloader, &skipModloader, "skip-modloader")
+	setBool(config.NoJava, &noJava, "no-java")
+	setString(config.JavaProvider, &javaProvider, "java-provider", "")
+	setBool(config.AcceptEula, &acceptEula, "accept-eula")
+	setBool(config.FabricLauncher, &fabricLaunch, "fabric-launcher")
+	setString(config.FabricLauncherSha256, &fabricLaunchHash, "fabric-launcher-sha256", "")
+	setString(config.CacheDir, &cacheDir, "cache-dir", "FTB_INSTALLER_CACHE_DIR")
+	setString(config.RuntimeDir, &runtimeDir, "runtime-dir", "FTB_INSTALLER_RUNTIME_DIR")
+	setString(config.UpdateChannel, &updateChannel, "update-channel", "FTB_INSTALLER_UPDATE_CHANNEL")
+	setString(config.InstallerVersion, &installerVersion, "installer-version", "")
+	setString(config.LocalEdits, &localEdits, "local-edits", "")
+	if config.CacheMaxSize != nil && !isFlagSet("cache-max-size") && os.Getenv("FTB_INSTALLER_CACHE_MAX_SIZE") == "" {
+		cacheMaxSize = *config.CacheMaxSize
+	}
+	if config.Channel != nil && !isFlagSet("latest") {
+		latest = *config.Channel == "latest"
+	}
+	if config.Memory != nil {
+		memoryOverride = *config.Memory
+	}
+	exclude = config.Exclude
+	return nil
+}
+
+func setString(value *string, dst *string, flagName, envName string) {
+	if value == nil || isFlagSet(flagName) || (envName != "" && os.Getenv(envName) != "") {
+		return
+	}
+	*dst = *value
+}
+
+func setInt(value *int, dst *int, flagName string) {
+	if value == nil || isFlagSet(flagName) {
+		return
+	}
+	*dst = *value
+}
+
+func setBool(value *bool, dst *bool, flagName string) {
+	if value == nil || isFlagSet(flagName) {
+		return
+	}
+	*dst = *value
+}
+
+// effectiveConfig is the config after merging the flags, environment variables and config file
+func effectiveConfig() structs.InstallerConfig {
+	channel := "release"
+	if latest {
+		channel = "latest"
+	}
+	key := apiKey
+	if envAPIKey, ok := os.LookupEnv("FTB_MODPACK_API_KEY"); ok && key == "public" {
+		key = envAPIKey
+	}
+	if key != "public" && key != "" {
+		key = "********"
+	}
+	config := structs.InstallerConfig{
+		Provider:             &provider,
+		Pack:                 &packId,
+		Version:              &versionId,
+		Project:              &project,
+		ProjectVersion:       &projectVer,
+		Source:               &source,
+		Channel:              &channel,
+		Dir:                  &installDir,
+		Threads:              &threads,
+		Timeout:              &dlTimeout,
+		ConnectTimeout:       &dialTimeout,
+		Proxy:                &proxy,
+		CACert:               &caCert,
+		Mirrors:              mirrors,
+		ApiKey:               &key,
+		Auto:                 &auto,
+		Force:                &force,
+		Validate:             &validate,
+		SkipModloader:        &skipModloader,
+		NoJava:               &noJava,
+		JavaProvider:         &javaProvider,
+		AcceptEula:           &acceptEula,
+		FabricLauncher:       &fabricLaunch,
+		FabricLauncherSha256: &fabricLaunchHash,
+		CacheDir:             &cacheDir,
+		CacheMaxSize:         &cacheMaxSize,
+		RuntimeDir:           &runtimeDir,
+		UpdateChannel:        &updateChannel,
+		InstallerVersion:     &installerVersion,
+		LocalEdits:           &localEdits,
+		Exclude:              exclude,
+	}
+	if memoryOverride != (structs.ConfigMemory{}) {
+		config.Memory = &memoryOverride
+	}
+	return config
+}
+
+func runConfigCommand(args []string) {
+	if len(args) == 0 || args[0] != "dump" {
+		fail(util.ExitUsage, "Usage: config dump")
+	}
+	config := effectiveConfig()
+	// The indented dump would break the one event per line stream, so it's an event of its own
+	if util.EventsEnabled() {
+		util.Emit(util.EventConfig, util.ConfigEvent{File: configPath, Config: config})
+		util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+		return
+	}
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		fail(util.ExitError, "Error encoding config:", err.Error())
+	}
+	if configPath != "" {
+		pterm.Info.Printfln("Config file: %s", configPath)
+	} else {
+		pterm.Info.Println("No config file found, showing flags and environment variables only")
+	}
+	fmt.Println(string(b))
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
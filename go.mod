@@ -3,15 +3,16 @@ module ftb-server-downloader
 go 1.26.4
 
 require (
+	aead.dev/minisign v0.3.0
 	github.com/codeclysm/extract/v4 v4.0.0
 	github.com/hashicorp/go-version v1.9.0
+	github.com/klauspost/compress v1.18.6
 	github.com/minio/selfupdate v0.6.0
 	github.com/pterm/pterm v0.12.83
 	golang.org/x/term v0.43.0
 )
 
 require (
-	aead.dev/minisign v0.3.0 // indirect
 	atomicgo.dev/cursor v0.2.0 // indirect
 	atomicgo.dev/keyboard v0.2.10 // indirect
 	atomicgo.dev/schedule v0.1.0 // indirect
@@ -20,7 +21,6 @@ require (
 	github.com/gookit/color v1.6.1 // indirect
 	github.com/h2non/filetype v1.1.3 // indirect
 	github.com/juju/errors v1.0.0 // indirect
-	github.com/klauspost/compress v1.18.6 // indirect
 	github.com/lithammer/fuzzysearch v1.1.8 // indirect
 	github.com/mattn/go-runewidth v0.0.23 // indirect
 	github.com/ulikunitz/xz v0.5.15 // indirect
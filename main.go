@@ -1,8 +1,8 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
@@ -14,41 +14,70 @@ import (
 	"ftb-server-downloader/structs"
 	"ftb-server-downloader/util"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/codeclysm/extract/v4"
 	"github.com/pterm/pterm"
 	"github.com/pterm/pterm/putils"
 	"golang.org/x/term"
 )
 
 var (
-	packId        int
-	versionId     int
-	installDir    string
-	threads       int
-	provider      string
-	auto          bool
-	force         bool
-	latest        bool
-	apiKey        string
-	validate      bool
-	skipModloader bool
-	noJava        bool
-	noColours     bool
-	dlTimeout     int
-	acceptEula    bool
-	verbose       bool
-
-	logFile *os.File
+	packId           int
+	versionId        int
+	project          string
+	projectVer       string
+	source           string
+	installDir       string
+	threads          int
+	provider         string
+	auto             bool
+	force            bool
+	latest           bool
+	apiKey           string
+	validate         bool
+	skipModloader    bool
+	noJava           bool
+	noColours        bool
+	dlTimeout        int
+	dialTimeout      int
+	proxy            string
+	caCert           string
+	mirrors          = mirrorFlag{}
+	acceptEula       bool
+	verbose          bool
+	fabricLaunch     bool
+	fabricLaunchHash string
+	cacheDir         string
+	cacheMaxSize     int64
+	runtimeDir       string
+	output           string
+	javaProvider     string
+	bundlePath       string
+	bundleOut        string
+	bundleOs         string
+	bundleArch       string
+	updateChannel    string
+	installerVersion string
+	localEdits       string
+
+	logFile       *os.File
+	downloadCache *util.Cache
+	runtimeStore  *util.RuntimeStore
+	// packArchive is the pack archive a provider downloaded to a temporary file, it's removed on exit
+	packArchive string
+	// updateCommitted is set once an update has been swapped into the install directory
+	updateCommitted bool
 )
 
 func init() {
@@ -75,9 +104,12 @@ func init() {
 }
 
 func main() {
-	flag.StringVar(&provider, "provider", "ftb", "Modpack provider (Currently only 'ftb' is supported)")
+	flag.StringVar(&provider, "provider", "ftb", "Modpack provider ('ftb', 'curseforge', 'modrinth' or 'local')")
 	flag.IntVar(&packId, "pack", 0, "Modpack ID")
 	flag.IntVar(&versionId, "version", 0, "Modpack version ID, if not provided, the latest version will be used")
+	flag.StringVar(&project, "project", "", "Modrinth project ID or slug (Only for the 'modrinth' provider)")
+	flag.StringVar(&projectVer, "project-version", "", "Modrinth version ID or version number, if not provided, the latest version will be used")
+	flag.StringVar(&source, "source", "", "Modpack zip/mrpack, json or extracted directory to install from (Only for the 'local' provider)")
 	flag.StringVar(&installDir, "dir", "", "Installation directory")
 	flag.BoolVar(&auto, "auto", false, "Dont ask questions, just install the server")
 	flag.BoolVar(&latest, "latest", false, "Gets the latest (alpha/beta/release) version of the modpack")
@@ -87,12 +119,39 @@ func main() {
 	flag.BoolVar(&validate, "validate", false, "Validate the modpack after install")
 	flag.BoolVar(&skipModloader, "skip-modloader", false, "Skip installing the modloader")
 	flag.BoolVar(&noJava, "no-java", false, "Do not install Java")
+	flag.StringVar(&javaProvider, "java-provider", "adoptium", fmt.Sprintf("Where to download java from, one of %s", strings.Join(util.JavaProviders, ", ")))
 	justFiles := flag.Bool("just-files", false, "Only download the files, do not install java or the modloader")
 	flag.BoolVar(&noColours, "no-colours", false, "Do not display console/terminal colours")
-	flag.IntVar(&dlTimeout, "timeout", 120, "File download timeout in seconds")
+	flag.IntVar(&dlTimeout, "timeout", 120, "Seconds a download can go without receiving any data before it's aborted and retried")
+	flag.IntVar(&dialTimeout, "connect-timeout", 30, "Seconds to wait when connecting to a server")
+	flag.StringVar(&proxy, "proxy", "", "Proxy URL for every request, defaults to the HTTPS_PROXY/HTTP_PROXY environment variables")
+	flag.StringVar(&caCert, "ca-cert", "", "PEM file of extra certificate authorities to trust, e.g. for a TLS intercepting proxy")
+	flag.Var(mirrors, "mirror", "Rewrite URLs starting with a prefix to a mirror, 'https://maven.minecraftforge.net=https://nexus.example.com/forge' (can be repeated)")
 	flag.BoolVar(&acceptEula, "accept-eula", false, "Accept the EULA for Minecraft. By using this flag you are indicating your agreement to Minecraft's EULA (https://account.mojang.com/documents/minecraft_eula)")
 	flag.BoolVar(&verbose, "verbose", false, "Verbose output")
-	flag.Parse()
+	flag.StringVar(&cacheDir, "cache-dir", "", "Shared download cache directory, can also be set with FTB_INSTALLER_CACHE_DIR (Disabled by default)")
+	flag.Int64Var(&cacheMaxSize, "cache-max-size", 10240, "Maximum size of the download cache in MB, least recently used files are evicted first (0 for unlimited)")
+	flag.StringVar(&runtimeDir, "runtime-dir", "", "Shared java runtime directory, e.g. ~/.ftb/runtimes, can also be set with FTB_INSTALLER_RUNTIME_DIR (Disabled by default, java is installed in each server)")
+	flag.StringVar(&output, "output", "text", "Output format, 'text' or 'json' (newline delimited JSON events on stdout, implies -auto)")
+	flag.BoolVar(&fabricLaunch, "fabric-launcher", false, "Use Fabric's prebuilt server launcher instead of running the Fabric installer (Does not require java, needs -fabric-launcher-sha256)")
+	flag.StringVar(&fabricLaunchHash, "fabric-launcher-sha256", "", "sha256 of the Fabric server launcher to verify it against, Fabric doesn't publish one (Only for -fabric-launcher)")
+	flag.StringVar(&bundlePath, "bundle", "", "Install or update from a bundle made with 'bundle create' without any network access")
+	flag.StringVar(&bundleOut, "out", "", "File to write the bundle to (Only for 'bundle create')")
+	flag.StringVar(&bundleOs, "os", runtime.GOOS, "Operating system the bundle is for, 'linux', 'windows' or 'darwin' (Only for 'bundle create')")
+	flag.StringVar(&bundleArch, "arch", runtime.GOARCH, "Architecture the bundle is for, 'amd64', 'arm64', '386' or 'arm' (Only for 'bundle create')")
+	flag.StringVar(&updateChannel, "update-channel", "stable", "Installer updates to offer, 'stable', 'beta' (includes prereleases) or 'none', can also be set with FTB_INSTALLER_UPDATE_CHANNEL")
+	flag.StringVar(&installerVersion, "installer-version", "", "Installer version to update or downgrade to, e.g. v1.2.3, instead of the newest on the update channel")
+	flag.StringVar(&localEdits, "local-edits", util.LocalEditsMerge, fmt.Sprintf("What updates do with pack files you've edited, one of %s", strings.Join(util.LocalEditPolicies, ", ")))
+	flag.StringVar(&configPath, "config", "", fmt.Sprintf("Config file to read flags from, defaults to %s next to the installer if it exists", util.ConfigName))
+	flag.Usage = usage
+
+	// The command can come before, after or between the flags, install is used when there isn't one
+	command := "install"
+	var commandArgs []string
+	if args := parseArgs(os.Args[1:]); len(args) > 0 {
+		command = args[0]
+		commandArgs = args[1:]
+	}
 
 	// Threads cannot be less than 1
 	if threads < 1 {
@@ -111,7 +170,17 @@ func main() {
 		panic(err)
 	}
 
-	util.LogMw = io.MultiWriter(os.Stdout, util.NewCustomWriter(logFile))
+	consoleOut := io.Writer(os.Stdout)
+	if output == "json" {
+		// stdout is kept for the event stream, everything meant for people goes to stderr
+		util.EnableEvents(os.Stdout)
+		util.CmdOutput = os.Stderr
+		consoleOut = os.Stderr
+		// Nobody is there to answer the prompts
+		auto = true
+	}
+
+	util.LogMw = io.MultiWriter(consoleOut, util.NewCustomWriter(logFile))
 
 	log.SetOutput(util.LogMw)
 	pterm.SetDefaultOutput(util.LogMw)
@@ -126,6 +195,33 @@ func main() {
 		pterm.DisableStyling()
 	}
 
+	if output != "text" && output != "json" {
+		fail(util.ExitUsage, fmt.Sprintf("Unknown output format '%s', valid formats are 'text' and 'json'", output))
+	}
+
+	// Flags take priority over environment variables, which take priority over the config file
+	if err = loadConfig(); err != nil {
+		fail(util.ExitUsage, "Error loading config:", err.Error())
+	}
+	if threads < 1 {
+		threads = runtime.NumCPU() * 2
+	}
+	if err = setupHTTP(); err != nil {
+		fail(util.ExitUsage, "Error setting up HTTP client:", err.Error())
+	}
+	if _, err = util.GetJavaProvider(javaProvider); err != nil {
+		fail(util.ExitUsage, err.Error())
+	}
+	if b, err := hex.DecodeString(fabricLaunchHash); err != nil || (fabricLaunchHash != "" && len(b) != sha256.Size) {
+		fail(util.ExitUsage, fmt.Sprintf("Invalid -fabric-launcher-sha256 '%s'", fabricLaunchHash))
+	}
+	if err = setupUpdates(); err != nil {
+		fail(util.ExitUsage, err.Error())
+	}
+	if !slices.Contains(util.LocalEditPolicies, localEdits) {
+		fail(util.ExitUsage, fmt.Sprintf("Unknown -local-edits policy '%s', valid policies are %s", localEdits, strings.Join(util.LocalEditPolicies, ", ")))
+	}
+
 	logo, _ := pterm.DefaultBigText.WithLetters(
 		putils.LettersFromStringWithStyle("F", pterm.NewStyle(pterm.FgCyan)),
 		putils.LettersFromStringWithStyle("T", pterm.NewStyle(pterm.FgGreen)),
@@ -134,29 +230,10 @@ func main() {
 	pterm.DefaultCenter.WithCenterEachLineSeparately().Printfln("Server installer version: %s(%s)\n%s", util.ReleaseVersion, util.GitCommit, time.Now().UTC().Format(time.RFC1123))
 	pterm.DefaultCenter.WithCenterEachLineSeparately().Println(pterm.Bold.Sprintf("Installer Issue tracker\nhttps://github.com/FTBTeam/FTB-Server-Installer/issues"))
 
-	versionInfo, err := checkForUpdate()
-	if err != nil {
-		pterm.Warning.Printfln("Error checking for installer update: %v", err)
-	}
-	if versionInfo.UpdateAvailable {
-		pterm.Info.Printfln("Installer update available:\nCurrent version: %s\nLatest version: %s", versionInfo.CurrentVersion, versionInfo.LatestVersion)
-		pterm.Println()
-		// Skip the update auto flag is set
-		if !auto {
-			update := util.ConfirmYN(
-				fmt.Sprintf("Do you want to update the installer to version %s?", versionInfo.LatestVersion),
-				true,
-				pterm.Info.MessageStyle,
-			)
-			if update {
-				pterm.Info.Println("Downloading update...")
-				err = doUpdate(versionInfo)
-				if err != nil {
-					pterm.Error.Printfln("Error updating installer: %s", err.Error())
-
-				}
-			}
-		}
+	// Commands that work on what's already installed must work offline, so they skip the installer update check.
+	// With -auto nobody can answer the prompt, so there's no point asking GitHub, self-update is used instead.
+	if updateChannel != "none" && !auto && command != "self-update" && !slices.Contains(offlineCommands, command) && bundlePath == "" {
+		promptForUpdate()
 	}
 
 	if verbose {
@@ -164,70 +241,115 @@ func main() {
 		pterm.Debug.Println("Verbose output enabled")
 	}
 
+	if err = setupCache(); err != nil {
+		fail(util.ExitError, "Error setting up download cache:", err.Error())
+	}
+	if err = setupRuntimeStore(); err != nil {
+		fail(util.ExitError, "Error setting up runtime directory:", err.Error())
+	}
+
 	abs, err := filepath.Abs(installDir)
 	if err != nil {
-		pterm.Fatal.Println("Error getting absolute path:", err.Error())
+		fail(util.ExitError, "Error getting absolute path:", err.Error())
 	}
 	installDir = abs
 
 	defer logFile.Close()
-	// Get the pack ID and version ID from the installer name if not provided as flags
-	if packId == 0 {
-		pId, vId, err := util.ParseInstallerName(filepath.Base(os.Args[0]))
+	switch command {
+	case "install":
+		runInstall(false)
+	case "update":
+		runInstall(true)
+	case "verify":
+		runVerify()
+	case "repair":
+		runRepair()
+	case "info":
+		runInfo()
+	case "uninstall":
+		runUninstall()
+	case "cache":
+		runCacheCommand(commandArgs)
+	case "runtimes":
+		runRuntimesCommand(commandArgs)
+	case "rollback":
+		runRollback()
+	case "config":
+		runConfigCommand(commandArgs)
+	case "bundle":
+		runBundleCommand(commandArgs)
+	case "self-update":
+		runSelfUpdate()
+	default:
+		fail(util.ExitUsage, fmt.Sprintf("Unknown command '%s', valid commands are %s", command, strings.Join(commands, ", ")))
+	}
+}
+
+// runInstall installs the modpack, or with updateOnly updates the modpack already installed in installDir
+func runInstall(updateOnly bool) {
+	var err error
+	var existingManifest structs.Manifest
+	if bundlePath != "" {
+		useBundle()
+		defer cleanupBundle()
+	}
+	if updateOnly {
+		existingManifest, err = readInstalledManifest()
 		if err != nil {
-			pterm.Warning.Println("Unable to parse installer name for modpack and version id:", err)
-			pId, vId, err = modpackQuestion()
-			if err != nil {
-				pterm.Fatal.Println(err)
-			}
+			fail(util.ExitUsage, err.Error())
 		}
-		packId = pId
-		if vId != 0 && versionId == 0 {
-			versionId = vId
+		// The pack id is known from the manifest, there's no need to ask for it
+		if packId == 0 && (provider == "ftb" || provider == "curseforge") {
+			packId = existingManifest.Id
 		}
+	} else {
+		setPackFromInstallerName()
 	}
 
-	// Get the provider
-	selectedProvider, err := getProvider()
+	selectedProvider := mustGetProvider()
+	modpack, modpackVersion, err := resolvePack(selectedProvider)
+	defer cleanupPackArchive()
 	if err != nil {
-		pterm.Fatal.Printfln("Error getting provider: %s\nValid providers are 'ftb'", err.Error())
+		selectedProvider.FailedInstall()
+		fail(util.ExitResolveFailed, err.Error())
 	}
-	pterm.Debug.Printfln("Got provider '%s'", provider)
-
-	var filesToDownload []structs.File
 
-	if selectedProvider == nil {
-		pterm.Fatal.Println("No provider selected")
-		return
+	if memoryOverride.Minimum > 0 {
+		modpackVersion.Memory.Minimum = memoryOverride.Minimum
 	}
-
-	// Get modpack details from the provider
-	modpack, err := selectedProvider.GetModpack()
-	if err != nil {
-		selectedProvider.FailedInstall()
-		pterm.Error.Println("Error getting modpack:", err.Error())
-		os.Exit(1)
+	if memoryOverride.Recommended > 0 {
+		modpackVersion.Memory.Recommended = memoryOverride.Recommended
 	}
-	pterm.Debug.Printfln("Modpack: %+v", modpack)
 
-	// Get the latest version id if not provided or if the latest flag is set
-	if versionId == 0 || latest {
-		latestVersion, err := getLatestRelease(modpack.Versions, latest)
+	// Overrides are tracked in the manifest like the downloaded files, so updates, rollback, verify and uninstall
+	// cover them too
+	withOverrides := modpackVersion.Overrides.Source != "" && copyOverrides()
+	if withOverrides {
+		overrideFiles, err := util.OverrideFiles(modpackVersion.Overrides)
 		if err != nil {
-			pterm.Error.Println("Error getting latest release:", err.Error())
-			os.Exit(1)
+			selectedProvider.FailedInstall()
+			fail(util.ExitResolveFailed, "Error reading overrides folder:", err.Error())
 		}
-		selectedProvider.SetVersionId(latestVersion.Id)
-		pterm.Debug.Printfln("No version provided or latest flag set, using latest version: %d", latestVersion.Id)
+		modpackVersion.Files = util.MergeOverrides(modpackVersion.Files, overrideFiles)
 	}
 
-	// Get the version information for the modpack from the provider
-	modpackVersion, err := selectedProvider.GetVersion()
-	if err != nil {
-		selectedProvider.FailedInstall()
-		pterm.Error.Println("Error getting modpack version:", err.Error())
-		os.Exit(1)
+	var excluded []structs.File
+	modpackVersion.Files, excluded = util.ExcludeFiles(modpackVersion.Files, exclude)
+	if len(excluded) > 0 {
+		pterm.Info.Printfln("Skipping %d files excluded by the config", len(excluded))
+		for _, f := range excluded {
+			pterm.Debug.Printfln("Excluded %s", filepath.Join(f.Path, f.Name))
+		}
 	}
+
+	// One file that would be written outside the server means the pack is broken or malicious, none of it is installed
+	for _, f := range modpackVersion.Files {
+		if _, err = util.SafeJoin(installDir, f.Path, f.Name); err != nil {
+			fail(util.ExitResolveFailed, "Modpack contains an unsafe file path:", err.Error())
+		}
+	}
+
+	var filesToDownload []structs.File
 	filesToDownload = append(filesToDownload, modpackVersion.Files...)
 
 	// build the version manifest
@@ -240,24 +362,35 @@ func main() {
 		Files:          modpackVersion.Files,
 	}
 
+	if updateOnly {
+		if !isSameModpack(existingManifest, manifest) {
+			fail(util.ExitUsage, fmt.Sprintf("%s is installed in %s, use the install command to replace it with %s", existingManifest.Name, installDir, manifest.Name))
+		}
+		if isSameModpackVersion(existingManifest, manifest) {
+			pterm.Success.Printfln("%s is already up to date (%s)", manifest.Name, manifest.VersionName)
+			util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+			return
+		}
+	}
+
 	// Check if the install location exists, if it doesn't, ask if they want to create the folder(s)
 	exists, err := util.PathExists(installDir)
 	if err != nil {
 		selectedProvider.FailedInstall()
-		pterm.Fatal.Println("Unable to check if path exists:", err.Error())
+		fail(util.ExitError, "Unable to check if path exists:", err.Error())
 	}
 	mkdir := true
 	if !exists {
 		if !auto {
 			mkdir = util.ConfirmYN(fmt.Sprintf("Install folder does not exists, do you want to create it? (%s)", installDir), true, pterm.Info.MessageStyle)
 			if !mkdir {
-				pterm.Error.Println("Installation path does not exist...")
-				os.Exit(1)
+				fail(util.ExitAborted, "Installation path does not exist...")
 			}
 		}
 	}
 
-	var updatedFiles, removedFiles, unchangedFiles []structs.File
+	var updatedFiles, removedFiles, unchangedFiles, editedFiles []structs.File
+	var previousManifest structs.Manifest
 	updateMsg := ""
 	isUpdate := false
 	if exists {
@@ -270,7 +403,7 @@ func main() {
 			installDirEmpty, err := util.IsEmptyDir(installDir)
 			if err != nil {
 				selectedProvider.FailedInstall()
-				pterm.Fatal.Println("Error checking if directory is empty:", err.Error())
+				fail(util.ExitError, "Error checking if directory is empty:", err.Error())
 			}
 
 			if !installDirEmpty {
@@ -278,14 +411,12 @@ func main() {
 					pterm.Warning.Printfln("Install directory is not empty, installing the modpack may cause issues")
 					cont := util.ConfirmYN("Would you like to continue?", false, pterm.Warning.MessageStyle)
 					if !cont {
-						pterm.Error.Println("Installation path is not empty, exiting...")
-						os.Exit(1)
+						fail(util.ExitAborted, "Installation path is not empty, exiting...")
 					}
 				}
 				if auto && !force {
 					pterm.Warning.Printfln("Install directory is not empty, installing the modpack may cause issues")
-					pterm.Warning.Printfln("To force install use the -force flag")
-					os.Exit(1)
+					fail(util.ExitAborted, "To force install use the -force flag")
 				}
 			}
 		}
@@ -294,7 +425,7 @@ func main() {
 			existingManifest, err := util.ReadManifest(installDir)
 			if err != nil {
 				selectedProvider.FailedInstall()
-				pterm.Fatal.Println("Error reading manifest:", err.Error())
+				fail(util.ExitError, "Error reading manifest:", err.Error())
 			}
 
 			/*
@@ -309,13 +440,12 @@ func main() {
 					pterm.Warning.Printfln("You currently have a different modpack installed, installing this modpack may cause issues")
 					cont := util.ConfirmYN("Would you like to continue?", false, pterm.Warning.MessageStyle)
 					if !cont {
-						os.Exit(1)
+						fail(util.ExitAborted, "Installation cancelled")
 					}
 				}
 				if auto && !force {
 					pterm.Warning.Printfln("You currently have a different modpack installed, installing this modpack may cause issues")
-					pterm.Warning.Printfln("To force install use the -force flag")
-					os.Exit(1)
+					fail(util.ExitAborted, "To force install use the -force flag")
 				}
 			}
 
@@ -328,20 +458,35 @@ func main() {
 				isUpdate, err = checkUpdate(existingManifest, manifest)
 				if err != nil {
 					selectedProvider.FailedInstall()
-					pterm.Fatal.Println("Check Update error:", err.Error())
+					fail(util.ExitError, "Check Update error:", err.Error())
 				}
 
 				if isUpdate {
 					existingManifest, err := util.ReadManifest(installDir)
 					if err != nil {
 						selectedProvider.FailedInstall()
-						pterm.Fatal.Println("Error reading manifest:", err.Error())
+						fail(util.ExitError, "Error reading manifest:", err.Error())
 						return
 					}
+					// Overrides that aren't copied this time are left as they are
+					if !withOverrides {
+						for _, f := range existingManifest.Files {
+							if f.Override {
+								manifest.Files = append(manifest.Files, f)
+							}
+						}
+					}
 					updatedFiles, removedFiles, unchangedFiles, err = computeUpdatedFiles(existingManifest.Files, manifest.Files)
 					if err != nil {
 						return
 					}
+					// A changed file that no longer matches the old manifest was edited since it was installed
+					editedFiles, err = util.LocallyEdited(installDir, updatedFiles)
+					if err != nil {
+						selectedProvider.FailedInstall()
+						fail(util.ExitInstallFailed, "Error checking for local edits:", err.Error())
+					}
+					previousManifest = existingManifest
 					filesToDownload = removeUnchangedFiles(filesToDownload, unchangedFiles)
 				}
 			}
@@ -349,23 +494,25 @@ func main() {
 	}
 
 	// set up the modloader getter and installer
-	modLoader, err := getModLoader(modpackVersion.Targets, modpackVersion.Memory)
+	modLoader, err := getModLoader(modpackVersion.Targets, modpackVersion.Memory, installDir)
 	if err != nil {
 		selectedProvider.FailedInstall()
-		pterm.Error.Println("Error getting modloader:", err.Error())
-		os.Exit(1)
+		fail(util.ExitResolveFailed, "Error getting modloader:", err.Error())
 	}
 
 	// Add the modloader downloads to the files list
 	mlDownloads, err := modLoader.GetDownload()
 	if err != nil {
 		selectedProvider.FailedInstall()
-		pterm.Fatal.Println("Error getting mod loader downloads:", err.Error())
+		fail(util.ExitResolveFailed, "Error getting mod loader downloads:", err.Error())
+	}
+	// A bundle made with the installer's output has nothing for the installer to do
+	if !bundledModLoader() {
+		filesToDownload = append(filesToDownload, mlDownloads...)
 	}
-	filesToDownload = append(filesToDownload, mlDownloads...)
 
 	if isUpdate {
-		updateMsg = fmt.Sprintf("\nUnchanged Files: %d\nFiles changed: %d\nFiles removed: %d", len(unchangedFiles), len(updatedFiles), len(removedFiles))
+		updateMsg = fmt.Sprintf("\nUnchanged Files: %d\nFiles changed: %d\nFiles removed: %d\nEdited locally: %d (%s)", len(unchangedFiles), len(updatedFiles), len(removedFiles), len(editedFiles), localEdits)
 	}
 
 	pterm.Debug.Printfln("Files to download: %d", len(filesToDownload))
@@ -375,26 +522,40 @@ func main() {
 	if !auto {
 		cont := util.ConfirmYN("Do you want to continue?", true, pterm.Info.MessageStyle)
 		if !cont {
-			os.Exit(1)
+			fail(util.ExitAborted, "Installation cancelled")
 		}
 	}
 	// Ask the user if they want to download java then set the noJava flag depending on their answer
 	var java structs.File
 	jreAlreadyExists := false
 	jrePath, _ := util.GetJavaPath(modpackVersion.Targets.JavaVersion)
-	if _, err = os.Stat(filepath.Join(installDir, jrePath)); err == nil {
+	runtimeName := ""
+	if runtimeStore != nil {
+		runtimeName = util.RuntimeName(javaProvider, modpackVersion.Targets.JavaVersion, runtime.GOARCH)
+		jrePath, _ = runtimeStore.JavaPath(runtimeName)
+		jreAlreadyExists, _ = runtimeStore.Has(runtimeName)
+	} else if _, err = os.Stat(filepath.Join(installDir, jrePath)); err == nil {
 		jreAlreadyExists = true
 	}
 
-	// If noJava is set, or we already have java downloaded, we skip the java download
-	if !noJava && !auto && !jreAlreadyExists {
+	// A java that's already installed is only used if it's the version the pack needs
+	var systemJava util.JavaRuntime
+	hasSystemJava := false
+	if !jreAlreadyExists {
+		systemJava, hasSystemJava = util.FindJava(modpackVersion.Targets.JavaVersion)
+	}
+
+	// If noJava is set, or we already have a usable java, we skip the java download
+	if !noJava && !auto && !jreAlreadyExists && !hasSystemJava {
 		noJava = !util.ConfirmYN("Do you want to download java?", true, pterm.Info.MessageStyle)
 	}
-	if !noJava && !jreAlreadyExists {
-		java, err = util.GetJava(modpackVersion.Targets.JavaVersion)
+	downloadJava := !noJava && !jreAlreadyExists && !hasSystemJava
+	if downloadJava {
+		pterm.Info.Printfln("No compatible java found, downloading java %s from %s", modpackVersion.Targets.JavaVersion, javaProvider)
+		java, err = getJava(modpackVersion.Targets.JavaVersion)
 		if err != nil {
 			selectedProvider.FailedInstall()
-			pterm.Fatal.Println("Error getting java:", err.Error())
+			fail(util.ExitResolveFailed, "Error getting java:", err.Error())
 		}
 		filesToDownload = append(filesToDownload, java)
 	}
@@ -403,30 +564,23 @@ func main() {
 		err = os.MkdirAll(installDir, 0777)
 		if err != nil {
 			selectedProvider.FailedInstall()
-			pterm.Fatal.Println("Unable to create install directory:", err.Error())
+			fail(util.ExitInstallFailed, "Unable to create install directory:", err.Error())
 		}
 	} else {
-		pterm.Error.Println("Installation path does not exist...")
-		os.Exit(1)
+		fail(util.ExitAborted, "Installation path does not exist...")
 	}
 
+	// Updates are downloaded into a staging folder and only swapped in once every file has downloaded,
+	// so a failed download can't leave the server half updated
+	downloadDir := installDir
+	var transaction *util.UpdateTransaction
 	if isUpdate {
-		for _, f := range removedFiles {
-			err := os.Remove(filepath.Join(installDir, f.Path, f.Name))
-			if err != nil {
-				pterm.Error.Printfln("Removing files error: %s", err.Error())
-				continue
-			}
-		}
-
-		// For now, we remove the files that have been updated so they can be freshly downloaded.
-		for _, f := range updatedFiles {
-			err := os.Remove(filepath.Join(installDir, f.Path, f.Name))
-			if err != nil {
-				pterm.Error.Printfln("Removing update files error: %s", err.Error())
-				continue
-			}
+		transaction, err = util.NewUpdateTransaction(installDir)
+		if err != nil {
+			selectedProvider.FailedInstall()
+			fail(util.ExitInstallFailed, "Error preparing update:", err.Error())
 		}
+		downloadDir = transaction.StagingDir
 
 		// Remove unchanged files from filesToDownload, we don't want to re-download unchanged files
 		for _, f := range unchangedFiles {
@@ -438,48 +592,116 @@ func main() {
 		}
 	}
 
+	var totalSize int64
+	for _, f := range filesToDownload {
+		totalSize += f.Size
+	}
+	util.Emit(util.EventFilesPlanned, util.FilesPlannedEvent{
+		IsUpdate:   isUpdate,
+		Files:      len(filesToDownload),
+		TotalBytes: totalSize,
+		Unchanged:  len(unchangedFiles),
+		Updated:    len(updatedFiles),
+		Removed:    len(removedFiles),
+		Edited:     len(editedFiles),
+	})
+
 	// download the modpack files
 	pterm.Info.Printfln("Starting mod pack download...")
-	err = downloadFiles(filesToDownload...)
+	// Ctrl+C cancels the downloads so the failed install is still reported
+	downloads, overrides := util.SplitOverrides(filesToDownload)
+	downloadCtx, stopDownloads := signal.NotifyContext(context.Background(), os.Interrupt)
+	err = downloadFiles(downloadCtx, downloadDir, downloads...)
+	stopDownloads()
 	if err != nil {
 		selectedProvider.FailedInstall()
-		pterm.Fatal.Println(err.Error())
+		if isUpdate {
+			pterm.Info.Println("Your server has not been changed, rerun the update to resume the download")
+		}
+		fail(util.ExitDownloadFailed, err.Error())
+	}
+	// The overrides go in with the downloads, on an update that means they're staged and backed up like the rest
+	err = util.CopyOverrides(modpackVersion.Overrides, overrides, downloadDir)
+	if err != nil {
+		selectedProvider.FailedInstall()
+		fail(util.ExitInstallFailed, "Error copying overrides folder:", err.Error())
+	}
+	if err = util.SaveOriginals(installDir, downloadDir, overrides); err != nil {
+		pterm.Warning.Println("Unable to keep the original overrides, edits to them can't be merged on the next update:", err.Error())
+	}
+	cleanupPackArchive()
+	// The versions the edited files were installed as are what the update gets merged into them against, the
+	// overrides were kept when they were installed
+	editedDownloads, _ := util.SplitOverrides(editedFiles)
+	if len(editedDownloads) > 0 && localEdits == util.LocalEditsMerge {
+		baseCtx, stopBase := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = downloadFiles(baseCtx, transaction.MergeBaseDir(), editedDownloads...)
+		stopBase()
+		if err != nil {
+			pterm.Warning.Println("Unable to download the original version of every edited file, those can't be merged:", err.Error())
+		}
+	}
+	if downloadCache != nil {
+		pruneCache()
 	}
 
-	pterm.Success.Printfln("Modpack files downloaded")
+	if isUpdate {
+		staged, replaced, edits, err := transaction.ResolveLocalEdits(localEdits, editedFiles, filesToDownload, append(removedFiles, updatedFiles...))
+		if err != nil {
+			selectedProvider.FailedInstall()
+			fail(util.ExitInstallFailed, "Error handling locally edited files:", err.Error())
+		}
+		err = transaction.Commit(staged, replaced, previousManifest)
+		if err != nil {
+			selectedProvider.FailedInstall()
+			fail(util.ExitInstallFailed, "Error applying update:", err.Error())
+		}
+		updateCommitted = true
+		// The new files are in place from here on, so the manifest goes in with them. Otherwise a failure in the
+		// steps below leaves them under the previous manifest and they'd show up as local edits. The start
+		// scripts still use the previous runtime until the modloader installer has run.
+		committedManifest := manifest
+		committedManifest.Runtime = previousManifest.Runtime
+		err = util.WriteManifest(installDir, committedManifest)
+		if err != nil {
+			selectedProvider.FailedInstall()
+			fail(util.ExitInstallFailed, "Error creating manifest:", err.Error())
+		}
+		pterm.Info.Printfln("Previous version backed up to %s, use the 'rollback' command to restore it", util.BackupDirName)
+		if len(editedFiles) > 0 {
+			reportLocalEdits(edits)
+		}
+	}
 
-	// If we downloaded java, extract the files to a jre folder
-	if !noJava && !jreAlreadyExists {
+	pterm.Success.Printfln("Modpack files downloaded")
 
-		javaFile, err := os.Open(filepath.Join(installDir, java.Name))
-		if err != nil {
+	// The reference is added before the runtime so a gc running alongside the install can't remove it
+	if runtimeStore != nil && !noJava && (jreAlreadyExists || downloadJava) {
+		if err = runtimeStore.AddReference(runtimeName, installDir); err != nil {
 			selectedProvider.FailedInstall()
-			pterm.Fatal.Println("Error opening java archive", err.Error())
-		}
-		javaPkg := bufio.NewReader(javaFile)
-
-		var shift = func(path string) string {
-			// Apparently zips in windows can use / instead of \
-			// So we need to check if the path is using / or \
-			sep := filepath.Separator
-			if len(strings.Split(path, "\\")) > 1 {
-				sep = '\\'
-			} else if len(strings.Split(path, "/")) > 1 {
-				sep = '/'
-			}
+			fail(util.ExitJavaFailed, "Error adding runtime reference:", err.Error())
+		}
+	}
 
-			parts := strings.Split(path, string(sep))
-			parts = parts[1:]
-			join := strings.Join(parts, string(sep))
-			return join
+	// If we downloaded java, extract the files to a jre folder, or the runtime directory if it's shared
+	if downloadJava {
+		javaArchive := filepath.Join(installDir, java.Name)
+		javaDir := filepath.Join(installDir, "jre", modpackVersion.Targets.JavaVersion)
+		if runtimeStore != nil {
+			javaDir = filepath.Join(runtimeStore.Dir, runtimeName)
+			err = runtimeStore.Add(runtimeName, javaArchive)
+		} else {
+			err = util.ExtractJava(javaArchive, javaDir)
 		}
-		err = extract.Archive(context.TODO(), javaPkg, filepath.Join(installDir, "jre", modpackVersion.Targets.JavaVersion), shift)
 		if err != nil {
 			selectedProvider.FailedInstall()
-			pterm.Fatal.Println("Error extracting java archive:", err.Error())
+			fail(util.ExitJavaFailed, "Error extracting java archive:", err.Error())
 		}
-		_ = javaFile.Close()
-		err = os.Remove(filepath.Join(installDir, java.Name))
+		util.Emit(util.EventJavaExtracted, util.JavaExtractedEvent{
+			JavaVersion: modpackVersion.Targets.JavaVersion,
+			Path:        javaDir,
+		})
+		err = os.Remove(javaArchive)
 		if err != nil {
 			pterm.Warning.Println("Error removing java archive:", err.Error())
 		}
@@ -494,16 +716,22 @@ func main() {
 			pterm.Info.MessageStyle,
 		)
 	}
-	if noJava && !util.OsJavaExists() {
+	javaPath := "java"
+	if !noJava && (jreAlreadyExists || downloadJava) {
+		javaPath = jrePath
+		manifest.Runtime = runtimeName
+	} else if hasSystemJava {
+		javaPath = systemJava.Path
+	} else if modLoader.RequiresJava() && !skipModloader && !bundledModLoader() {
 		// Revisit this, and possibly ask if they want to download java
-		pterm.Warning.Printfln("Java is not installed, skipping modloader installer")
+		pterm.Warning.Printfln("No compatible java %s is installed, skipping modloader installer", modpackVersion.Targets.JavaVersion)
 		skipModloader = true
 	}
 	if !skipModloader {
-		err = modLoader.Install(!noJava)
+		err = installModLoader(modLoader, javaPath)
 		if err != nil {
 			selectedProvider.FailedInstall()
-			pterm.Fatal.Println("ModLoader installer error:", err.Error())
+			fail(util.ExitModloaderFailed, "ModLoader installer error:", err.Error())
 		}
 	}
 
@@ -512,25 +740,25 @@ func main() {
 		err = runValidation(manifest)
 		if err != nil {
 			selectedProvider.FailedInstall()
-			pterm.Fatal.Println("Error running validation:", err.Error())
+			fail(util.ExitValidationFailed, "Error running validation:", err.Error())
 		}
 	}
 
+	// The start scripts aren't rewritten without the modloader installer, so they still use the old runtime
+	if skipModloader && manifest.Runtime == "" {
+		manifest.Runtime = previousManifest.Runtime
+	}
+
 	// write the version manifest
 	err = util.WriteManifest(installDir, manifest)
 	if err != nil {
 		selectedProvider.FailedInstall()
-		pterm.Fatal.Println("Error creating manifest:", err.Error())
+		fail(util.ExitInstallFailed, "Error creating manifest:", err.Error())
 	}
-
-	/*// Ask if the user would like to copy the overrides
-	overridesExist, err := util.PathExists(filepath.Join(installDir, "overrides"))
-	if err != nil {
-		pterm.Fatal.Println("Error checking if overrides exists:", err.Error())
+	// The originals of the previous version stay for a rollback
+	if err = util.PruneOriginals(installDir, manifest.Files, previousManifest.Files); err != nil {
+		pterm.Warning.Println("Unable to remove unused original overrides:", err.Error())
 	}
-	if overridesExist {
-		copyOverriddenFiles()
-	}*/
 
 	selectedProvider.SuccessfulInstall()
 	if acceptEula {
@@ -542,6 +770,129 @@ func main() {
 		}
 	}
 	pterm.Success.Println("Modpack installed successfully")
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
+
+// reportLocalEdits lists what the update did with each file that was edited since it was installed
+func reportLocalEdits(report util.LocalEditsEvent) {
+	for _, name := range report.Merged {
+		pterm.Info.Printfln("Merged the update into your edited %s", name)
+	}
+	for _, name := range report.Kept {
+		pterm.Info.Printfln("Kept your edited %s, the new version is in %s.new", name, name)
+	}
+	for _, name := range report.Conflicts {
+		pterm.Warning.Printfln("Kept your edited %s, the update conflicts with it. The new version is in %s.new and the original in %s.orig", name, name, name)
+	}
+	for _, name := range report.Overwritten {
+		pterm.Warning.Printfln("Replaced your edited %s, your version is in %s", name, util.BackupDirName)
+	}
+	pterm.Info.Printfln("Edited files: %d merged, %d kept, %d conflicts, %d replaced", len(report.Merged), len(report.Kept), len(report.Conflicts), len(report.Overwritten))
+	util.Emit(util.EventLocalEdits, report)
+}
+
+// fail ends the install with one of the util.Exit codes, the message is logged and reported as the final
+// status event for -output json
+func fail(code int, a ...any) {
+	msg := strings.TrimSuffix(fmt.Sprintln(a...), "\n")
+	pterm.Error.Println(msg)
+	if updateCommitted {
+		pterm.Info.Println("The update was applied but not finished, use the 'rollback' command to restore the previous version")
+	}
+	util.Emit(util.EventStatus, util.StatusEvent{Success: false, ExitCode: code, Error: msg})
+	cleanupPackArchive()
+	cleanupBundle()
+	if logFile != nil {
+		_ = logFile.Close()
+	}
+	os.Exit(code)
+}
+
+// setPackFromInstallerName gets the pack ID and version ID from the installer name if not provided as flags
+func setPackFromInstallerName() {
+	if packId != 0 || (provider != "ftb" && provider != "curseforge") {
+		return
+	}
+	pId, vId, err := util.ParseInstallerName(filepath.Base(os.Args[0]))
+	if err != nil {
+		pterm.Warning.Println("Unable to parse installer name for modpack and version id:", err)
+		pId, vId, err = modpackQuestion()
+		if err != nil {
+			fail(util.ExitUsage, err)
+		}
+	}
+	packId = pId
+	if vId != 0 && versionId == 0 {
+		versionId = vId
+	}
+}
+
+// mustGetProvider gets the provider selected by the flags, exiting if it can't be set up
+func mustGetProvider() repos.ModpackRepo {
+	selectedProvider, err := getProvider()
+	if err != nil {
+		fail(util.ExitUsage, fmt.Sprintf("Error getting provider: %s\nValid providers are 'ftb', 'curseforge', 'modrinth', 'local'", err.Error()))
+	}
+	if selectedProvider == nil {
+		fail(util.ExitUsage, "No provider selected")
+	}
+	pterm.Debug.Printfln("Got provider '%s'", provider)
+	return selectedProvider
+}
+
+// resolvePack gets the modpack and the version to install from the provider, using the latest release if
+// no version was given
+func resolvePack(selectedProvider repos.ModpackRepo) (structs.Modpack, structs.ModpackVersion, error) {
+	// Get modpack details from the provider
+	modpack, err := selectedProvider.GetModpack()
+	if err != nil {
+		return structs.Modpack{}, structs.ModpackVersion{}, fmt.Errorf("error getting modpack: %s", err.Error())
+	}
+	pterm.Debug.Printfln("Modpack: %+v", modpack)
+
+	// Get the latest version id if not provided or if the latest flag is set
+	if (versionId == 0 && projectVer == "") || latest {
+		latestVersion, err := getLatestRelease(modpack.Versions, latest)
+		if err != nil {
+			return structs.Modpack{}, structs.ModpackVersion{}, fmt.Errorf("error getting latest release: %s", err.Error())
+		}
+		selectedProvider.SetVersionId(latestVersion.Id)
+		pterm.Debug.Printfln("No version provided or latest flag set, using latest version: %d", latestVersion.Id)
+	}
+
+	// Get the version information for the modpack from the provider
+	modpackVersion, err := selectedProvider.GetVersion()
+	if err != nil {
+		return structs.Modpack{}, structs.ModpackVersion{}, fmt.Errorf("error getting modpack version: %s", err.Error())
+	}
+	if modpackVersion.Overrides.Temporary {
+		packArchive = modpackVersion.Overrides.Source
+	}
+
+	util.Emit(util.EventPackResolved, util.PackResolvedEvent{
+		Provider:         provider,
+		PackId:           modpack.Id,
+		PackName:         modpack.Name,
+		VersionId:        modpackVersion.Id,
+		VersionName:      modpackVersion.Name,
+		McVersion:        modpackVersion.Targets.McVersion,
+		ModLoader:        modpackVersion.Targets.ModLoader.Name,
+		ModLoaderVersion: modpackVersion.Targets.ModLoader.Version,
+		JavaVersion:      modpackVersion.Targets.JavaVersion,
+		InstallDir:       installDir,
+	})
+	return modpack, modpackVersion, nil
+}
+
+// cleanupPackArchive removes the pack archive resolvePack left in a temporary file, if there is one
+func cleanupPackArchive() {
+	if packArchive == "" {
+		return
+	}
+	if err := os.Remove(packArchive); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		pterm.Warning.Printfln("Unable to remove %s: %s", packArchive, err.Error())
+	}
+	packArchive = ""
 }
 
 // getProvider Gets and sets up the repo provider
@@ -552,89 +903,235 @@ func getProvider() (repos.ModpackRepo, error) {
 		}
 	}
 	util.ApiKey = apiKey
+	if envCfApiKey, ok := os.LookupEnv("CURSEFORGE_API_KEY"); ok && envCfApiKey != "" {
+		util.CfApiKey = envCfApiKey
+	}
 	switch provider {
 	case "ftb":
 		return repos.GetFTB(packId, versionId), nil
-	// case "curseforge":
-	//	return repos.GetCurseForge(packId, versionId), nil
+	case "curseforge":
+		return repos.GetCurseForge(packId, versionId), nil
+	case "modrinth":
+		if project == "" {
+			return nil, errors.New("the modrinth provider requires the -project flag")
+		}
+		return repos.GetModrinth(project, projectVer), nil
+	case "local":
+		if source == "" {
+			return nil, errors.New("the local provider requires the -source flag")
+		}
+		return repos.GetLocal(source, versionId), nil
 	default:
 		return nil, errors.New(fmt.Sprintf("'%s' not recognised", provider))
 	}
 }
 
-// getModLoader function to get the correct modloader for the pack
-func getModLoader(targets structs.ModpackTargets, memory structs.Memory) (modloaders.ModLoader, error) {
+// getModLoader function to get the correct modloader for the pack, installing into dir
+func getModLoader(targets structs.ModpackTargets, memory structs.Memory, dir string) (modloaders.ModLoader, error) {
 	switch targets.ModLoader.Name {
 	case "neoforge":
-		return modloaders.GetNeoForge(targets, memory, installDir), nil
+		return modloaders.GetNeoForge(targets, memory, dir), nil
 	case "fabric":
-		return modloaders.GetFabric(targets, memory, installDir)
+		fabric, err := modloaders.GetFabric(targets, memory, dir)
+		if err != nil {
+			return nil, err
+		}
+		fabric.UseServerLauncher = fabricLaunch
+		fabric.LauncherHash = fabricLaunchHash
+		return fabric, nil
 	case "forge":
-		return modloaders.GetForge(targets, memory, installDir), nil
+		return modloaders.GetForge(targets, memory, dir), nil
+	case "quilt":
+		return modloaders.GetQuilt(targets, memory, dir)
 	default:
 		return nil, errors.New(fmt.Sprintf("'%s' not recognised", targets.ModLoader.Name))
 	}
 }
 
-func downloadFiles(files ...structs.File) error {
+// downloadFiles downloads files into destDir using the configured number of threads. The first failed file
+// cancels the downloads still running, every file that failed is returned in a util.DownloadErrors so the
+// caller can decide whether to abort or carry on.
+func downloadFiles(ctx context.Context, destDir string, files ...structs.File) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var wg sync.WaitGroup
 	var mu sync.Mutex
-	// Use atomic to keep track of the progress bar
-	var pCount atomic.Uint64
+	var failed util.DownloadErrors
+	var filesDone atomic.Int64
 	threadLimit := make(chan struct{}, threads)
 
-	p, _ := pterm.DefaultProgressbar.WithTitle("Downloading...").WithTotal(len(files)).Start()
+	var totalSize int64
+	for _, f := range files {
+		totalSize += f.Size
+	}
+	progress := util.NewProgress(totalSize)
+	stopReporting := reportProgress(progress, &filesDone, len(files))
 
+dispatch:
 	for _, file := range files {
+		select {
+		case threadLimit <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
 		wg.Add(1)
-		threadLimit <- struct{}{}
 		fileCopy := file
 		go func(f structs.File) {
 			defer func() {
 				<-threadLimit
-				count := pCount.Add(1)
-				if count%5 == 0 || count == uint64(len(files)) {
-					mu.Lock()
-					p.Current = int(count)
-					mu.Unlock()
-				}
+				filesDone.Add(1)
 				wg.Done()
 			}()
-			err := doDownload(f)
+			event := util.DownloadEvent{Path: filepath.ToSlash(filepath.Join(f.Path, f.Name)), Url: f.Url, Size: f.Size}
+			util.Emit(util.EventDownloadStart, event)
+			cached, err := doDownload(ctx, destDir, f, progress.Tracker(f.Size))
 			if err != nil {
+				// Downloads stopped because another file failed aren't failures of their own
+				if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+					return
+				}
+				event.Error = err.Error()
+				util.Emit(util.EventDownloadFail, event)
 				pterm.Error.Printfln("Failed to download file: %s\nAll mirrors failed\n%s", filepath.Join(f.Path, f.Name), err.Error())
 				pterm.Debug.Println(err)
-				os.Exit(1)
+				mu.Lock()
+				failed = append(failed, util.FileDownloadError{File: f, Err: err})
+				mu.Unlock()
+				cancel()
+				return
 			}
+			event.Cached = cached
+			util.Emit(util.EventDownloadFinish, event)
 		}(fileCopy)
 	}
 	// Wait for all downloads to finish
 	wg.Wait()
 
-	// Update the progress bar to show that the downloads are complete
-	p.Current = int(pCount.Load())
-	_, err := p.UpdateTitle("Download complete").Stop()
-	if err != nil {
-		return err
+	if len(failed) > 0 || ctx.Err() != nil {
+		stopReporting(false)
+		if len(failed) > 0 {
+			return failed
+		}
+		return ctx.Err()
 	}
+	stopReporting(true)
 
 	return nil
 }
 
-func doDownload(file structs.File) error {
-	destPath := filepath.Join(installDir, file.Path, file.Name)
+// reportProgress shows the progress of a download until the returned func is called. Interactive installs
+// get a progress bar, with -auto a log line is printed every few seconds instead as a progress bar is
+// unreadable in CI logs.
+func reportProgress(progress *util.Progress, filesDone *atomic.Int64, fileCount int) func(success bool) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	status := func() string {
+		return fmt.Sprintf("%d/%d files | %s", filesDone.Load(), fileCount, progress.String())
+	}
+
+	if auto {
+		go func() {
+			defer close(stopped)
+			ticker := time.NewTicker(10 * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					progress.Sample()
+					pterm.Info.Printfln("Downloading: %s", status())
+				case <-done:
+					return
+				}
+			}
+		}()
+		return func(success bool) {
+			close(done)
+			<-stopped
+			if success {
+				pterm.Info.Printfln("Downloaded %d files (%s)", fileCount, util.FormatBytes(progress.Done()))
+			}
+		}
+	}
+
+	p, _ := pterm.DefaultProgressbar.WithTitle("Downloading...").WithShowCount(false).WithTotal(1).Start()
+	update := func() {
+		// Total grows as files with an unknown size start, keep it ahead of Current so the bar doesn't stop itself
+		total := progress.Total()
+		if total <= progress.Done() {
+			total = progress.Done() + 1
+		}
+		p.Total = int(total)
+		p.Current = int(progress.Done())
+		p.UpdateTitle(status())
+	}
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		samples := 0
+		for {
+			select {
+			case <-ticker.C:
+				// Sample the speed every other tick, it's too jumpy to read otherwise
+				if samples++; samples%2 == 0 {
+					progress.Sample()
+				}
+				update()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func(success bool) {
+		close(done)
+		<-stopped
+		update()
+		if success {
+			p.Current = p.Total
+			p.UpdateTitle(fmt.Sprintf("Download complete | %d files | %s", fileCount, util.FormatBytes(progress.Done())))
+		} else {
+			p.UpdateTitle("Download failed")
+		}
+		_, _ = p.Stop()
+	}
+}
+
+// doDownload downloads a single file trying each mirror in turn, returns true if it came from the download cache
+func doDownload(ctx context.Context, destDir string, file structs.File, progress util.ProgressFunc) (bool, error) {
+	destPath, err := util.SafeJoin(destDir, file.Path, file.Name)
+	if err != nil {
+		return false, err
+	}
 	mirrors := append([]string{file.Url}, file.Mirrors...)
 
+	if downloadCache != nil && file.Hash != "" {
+		hit, err := downloadCache.Get(file, destPath)
+		if err != nil {
+			pterm.Debug.Printfln("Unable to use cache for %s: %s", file.Name, err.Error())
+		}
+		if hit {
+			if info, err := os.Stat(destPath); err == nil {
+				progress(info.Size(), info.Size())
+			}
+			return true, nil
+		}
+	}
+
 	for m, mirror := range mirrors {
 		for attempts := 0; attempts < 3; attempts++ {
 			pterm.Debug.Printfln("Downloading file: %s from %s | attempt: %d | Mirrors %d", file.Name, mirror, attempts+1, len(mirrors))
 
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+
 			dl, err := util.NewDownload(destPath, mirror)
 			if err != nil {
 				pterm.Error.Printfln("Error creating download: %s", err.Error())
-				c, b, err := util.FailedDownloadHandler(attempts, m, file, mirror, mirrors)
+				c, b, err := util.FailedDownloadHandler(ctx, attempts, m, file, mirror, mirrors)
 				if err != nil {
-					return err
+					return false, err
 				} else if b {
 					break
 				} else if c {
@@ -642,7 +1139,7 @@ func doDownload(file structs.File) error {
 				}
 			}
 			if dl == nil {
-				return errors.New(fmt.Sprintf("download object is nil for file %s", file.Name))
+				return false, errors.New(fmt.Sprintf("download object is nil for file %s", file.Name))
 			}
 			if file.Hash != "" {
 				hexHash, _ := hex.DecodeString(file.Hash)
@@ -651,17 +1148,21 @@ func doDownload(file structs.File) error {
 					dl.SetChecksum(sha1.New(), hexHash, true)
 				case "sha256":
 					dl.SetChecksum(sha256.New(), hexHash, true)
+				case "md5":
+					dl.SetChecksum(md5.New(), hexHash, true)
 				default:
 					pterm.Warning.Printfln("Unsupported hash type: %s", file.HashType)
 				}
 			}
+			dl.SetContext(ctx)
+			dl.SetProgressFunc(progress)
 			dl.CheckContentLength(file.CheckContentLength)
 			err = dl.Do()
 			if err != nil {
 				pterm.Error.Printfln("Download request error: %s", err.Error())
-				c, b, err := util.FailedDownloadHandler(attempts, m, file, mirror, mirrors)
+				c, b, err := util.FailedDownloadHandler(ctx, attempts, m, file, mirror, mirrors)
 				if err != nil {
-					return err
+					return false, err
 				} else if b {
 					break
 				} else if c {
@@ -669,7 +1170,13 @@ func doDownload(file structs.File) error {
 				}
 			}
 
-			return nil
+			// Only files we could verify go in the cache
+			if downloadCache != nil && file.Hash != "" {
+				if err := downloadCache.Put(file, destPath); err != nil {
+					pterm.Debug.Printfln("Unable to add %s to the cache: %s", file.Name, err.Error())
+				}
+			}
+			return false, nil
 			/*if attempts < 2 {
 				sleepTime := util.BackoffTimes[attempts]
 				pterm.Warning.Printfln("Failed to download file %s from %s, retrying in %s", file.Name, mirror, sleepTime.String())
@@ -682,24 +1189,172 @@ func doDownload(file structs.File) error {
 			}*/
 		}
 	}
+	return false, nil
+}
+
+// setupHTTP applies the timeout, proxy, CA and mirror flags to the HTTP client shared by every request
+func setupHTTP() error {
+	return util.SetHTTPOptions(httpOptions())
+}
+
+// httpOptions builds the HTTP client options from the flags
+func httpOptions() util.HTTPOptions {
+	opts := util.DefaultHTTPOptions
+	if dialTimeout > 0 {
+		opts.DialTimeout = time.Duration(dialTimeout) * time.Second
+		opts.TLSHandshakeTimeout = time.Duration(dialTimeout) * time.Second
+	}
+	if dlTimeout > 0 {
+		opts.ResponseHeaderTimeout = time.Duration(dlTimeout) * time.Second
+		opts.IdleReadTimeout = time.Duration(dlTimeout) * time.Second
+	}
+	opts.Proxy = proxy
+	opts.CACertFile = caCert
+	opts.Mirrors = mirrors
+	return opts
+}
+
+// mirrorFlag collects the -mirror from=to flags
+type mirrorFlag map[string]string
+
+func (m mirrorFlag) String() string {
+	var rules []string
+	for from, to := range m {
+		rules = append(rules, from+"="+to)
+	}
+	return strings.Join(rules, ",")
+}
+
+func (m mirrorFlag) Set(value string) error {
+	from, to, ok := strings.Cut(value, "=")
+	if !ok || from == "" || to == "" {
+		return errors.New("mirror must be in the form <url prefix>=<mirror url>")
+	}
+	m[from] = to
+	return nil
+}
+
+// setupCache creates the shared download cache if one has been configured
+func setupCache() error {
+	if cacheDir == "" {
+		cacheDir = os.Getenv("FTB_INSTALLER_CACHE_DIR")
+	}
+	if envMaxSize, ok := os.LookupEnv("FTB_INSTALLER_CACHE_MAX_SIZE"); ok && !isFlagSet("cache-max-size") {
+		size, err := strconv.ParseInt(envMaxSize, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid FTB_INSTALLER_CACHE_MAX_SIZE: %s", err.Error())
+		}
+		cacheMaxSize = size
+	}
+	if cacheDir == "" {
+		return nil
+	}
+
+	abs, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return err
+	}
+	downloadCache, err = util.NewCache(abs, cacheMaxSize*1024*1024)
+	if err != nil {
+		return err
+	}
+	pterm.Debug.Printfln("Using download cache %s (max %d MB)", abs, cacheMaxSize)
 	return nil
 }
 
-func runValidation(manifest structs.Manifest) error {
-	var invalidFiles []structs.File
-	for _, f := range manifest.Files {
-		if f.HashType != "" && f.Hash != "" {
-			fileHash, err := util.FileHash(filepath.Join(installDir, f.Path, f.Name), f.HashType)
-			if err != nil {
-				pterm.Error.Println("Error getting file hash:", err.Error())
-				continue
-			}
-			if fileHash != f.Hash {
-				pterm.Warning.Printfln("Unexpected file hash from %s\nExpected: %s\nGot: %s", f.Name, f.Hash, fileHash)
-				invalidFiles = append(invalidFiles, f)
-			}
+// setupRuntimeStore opens the shared java runtime directory if one has been configured
+func setupRuntimeStore() error {
+	if runtimeDir == "" {
+		runtimeDir = os.Getenv("FTB_INSTALLER_RUNTIME_DIR")
+	}
+	if runtimeDir == "" {
+		return nil
+	}
+
+	abs, err := filepath.Abs(runtimeDir)
+	if err != nil {
+		return err
+	}
+	runtimeStore, err = util.NewRuntimeStore(abs)
+	if err != nil {
+		return err
+	}
+	pterm.Debug.Printfln("Using runtime directory %s", abs)
+	return nil
+}
+
+func pruneCache() {
+	removed, freed, err := downloadCache.Prune()
+	if err != nil {
+		pterm.Warning.Println("Error pruning download cache:", err.Error())
+		return
+	}
+	if removed > 0 {
+		pterm.Info.Printfln("Removed %d files (%.1f MB) from the download cache", removed, float64(freed)/1024/1024)
+	}
+}
+
+// isFlagSet reports if a flag was passed on the command line rather than left at its default
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
 		}
+	})
+	return set
+}
+
+// checkFiles verifies the install against the manifest, returning the files that are missing or don't match their hash
+func checkFiles(manifest structs.Manifest) (util.VerifyReport, util.ValidationEvent, error) {
+	report, err := util.VerifyInstall(installDir, manifest)
+	if err != nil {
+		return report, util.ValidationEvent{}, err
+	}
+
+	result := util.ValidationEvent{
+		Checked:  report.Checked,
+		Invalid:  []string{},
+		Missing:  []string{},
+		Modified: []string{},
+		Extra:    append([]string{}, report.Extra...),
+	}
+	for _, f := range report.Missing {
+		name := filepath.ToSlash(filepath.Join(f.Path, f.Name))
+		pterm.Warning.Printfln("Missing file %s", name)
+		result.Missing = append(result.Missing, name)
+		result.Invalid = append(result.Invalid, name)
+	}
+	for _, f := range report.Modified {
+		name := filepath.ToSlash(filepath.Join(f.Path, f.Name))
+		pterm.Warning.Printfln("Modified file %s, expected %s hash %s", name, f.HashType, f.Hash)
+		result.Modified = append(result.Modified, name)
+		result.Invalid = append(result.Invalid, name)
 	}
+	for _, name := range report.Extra {
+		pterm.Warning.Printfln("Untracked file %s", name)
+	}
+	return report, result, nil
+}
+
+// repairableFiles leaves out the files copied from the modpack's overrides, there's nowhere to download them from
+func repairableFiles(files []structs.File) []structs.File {
+	downloads, overrides := util.SplitOverrides(files)
+	for _, f := range overrides {
+		pterm.Warning.Printfln("%s comes from the modpack's overrides and can't be downloaded again, install the modpack again to restore it", filepath.ToSlash(filepath.Join(f.Path, f.Name)))
+	}
+	return downloads
+}
+
+func runValidation(manifest structs.Manifest) error {
+	report, result, err := checkFiles(manifest)
+	if err != nil {
+		return err
+	}
+	invalidFiles := report.Invalid()
+	defer func() {
+		util.Emit(util.EventValidation, result)
+	}()
 
 	if len(invalidFiles) > 0 {
 		if !auto {
@@ -713,10 +1368,12 @@ func runValidation(manifest structs.Manifest) error {
 			}
 		}
 
-		err := downloadFiles(invalidFiles...)
+		downloads := repairableFiles(invalidFiles)
+		err := downloadFiles(context.Background(), installDir, downloads...)
 		if err != nil {
 			return err
 		}
+		result.Repaired = len(downloads) == len(invalidFiles)
 	}
 
 	return nil
@@ -747,6 +1404,11 @@ func checkUpdate(currentManifest, newManifest structs.Manifest) (isUpdate bool,
 	}
 
 	if currentManifest.VersionId != newManifest.VersionId {
+		// Local CurseForge and Modrinth packs are versioned by a hash of their pack json, a different id is a
+		// different pack file and there's no telling if it's older
+		if provider == "local" {
+			return true, nil
+		}
 		if newManifest.VersionId > currentManifest.VersionId {
 			return true, nil
 		}
@@ -758,13 +1420,11 @@ func checkUpdate(currentManifest, newManifest structs.Manifest) (isUpdate bool,
 					pterm.Warning.MessageStyle,
 				)
 				if !show {
-					pterm.Info.Println("Cancelling update...")
-					os.Exit(0)
+					fail(util.ExitAborted, "Cancelling update...")
 				}
 			}
 			if auto && !force {
-				pterm.Warning.Printfln("Cancelling update... %s would be downgraded from %s to %s. To force this downgrade use the -force flag", newManifest.Name, currentManifest.VersionName, newManifest.VersionName)
-				os.Exit(1)
+				fail(util.ExitAborted, fmt.Sprintf("Cancelling update... %s would be downgraded from %s to %s. To force this downgrade use the -force flag", newManifest.Name, currentManifest.VersionName, newManifest.VersionName))
 			} else if auto && force {
 				pterm.Warning.Printfln("Forcing downgrade")
 			}
@@ -859,18 +1519,12 @@ func modpackQuestion() (int, int, error) {
 	return pId, vId, nil
 }
 
-/*func copyOverriddenFiles() {
-	pterm.Info.Printfln("Overrides folder found")
-	doCopy := true
-	if !auto {
-		doCopy = util.ConfirmYN("Would you like to copy the overrides folder contents?", true, pterm.Info.MessageStyle)
-	} else {
+// copyOverrides asks if the modpack's overrides should be installed along with its files
+func copyOverrides() bool {
+	pterm.Info.Printfln("Modpack overrides found")
+	if auto {
 		pterm.Info.Printfln("Copying overrides folder contents")
+		return true
 	}
-	if doCopy {
-		err := util.CopyDir(filepath.Join(installDir, "overrides"), filepath.Join(installDir))
-		if err != nil {
-			pterm.Fatal.Println("Error copying overrides folder:", err.Error())
-		}
-	}
-}*/
+	return util.ConfirmYN("Would you like to copy the overrides folder contents?", true, pterm.Info.MessageStyle)
+}
@@ -2,18 +2,22 @@ package modloaders
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"ftb-server-downloader/structs"
 	"ftb-server-downloader/util"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 
 	"github.com/pterm/pterm"
 )
 
-const fabricMeta = "https://meta.fabricmc.net"
+const (
+	fabricMeta       = "https://meta.fabricmc.net"
+	fabricLaunchJar  = "fabric-server-launch.jar"
+	fabricVanillaJar = "server.jar"
+)
 
 type Fabric struct {
 	InstallDir      string
@@ -21,6 +25,10 @@ type Fabric struct {
 	Memory          structs.Memory
 	IsAutoVersion   bool
 	FabricInstaller FabricInstaller
+	// UseServerLauncher downloads Fabric's prebuilt server launcher instead of running the installer with java
+	UseServerLauncher bool
+	// LauncherHash is the sha256 the server launcher is verified against, Fabric doesn't publish one
+	LauncherHash string
 }
 
 type FabricInstaller struct {
@@ -47,16 +55,46 @@ func GetFabric(target structs.ModpackTargets, memory structs.Memory, installDir
 func (s Fabric) GetDownload() ([]structs.File, error) {
 	var mlFiles []structs.File
 
+	if s.UseServerLauncher {
+		return s.getLauncherDownload()
+	}
+
+	// The meta only has the installer's maven url, the checksum comes from the maven
+	hash, hashType, err := util.MavenChecksum(s.FabricInstaller.URL)
+	if err != nil {
+		return mlFiles, err
+	}
 	mlFiles = append(mlFiles, structs.File{
 		Name:               fmt.Sprintf("fabric-installer-%s.jar", s.FabricInstaller.Version),
 		Url:                s.FabricInstaller.URL,
+		Hash:               hash,
+		HashType:           hashType,
 		CheckContentLength: true,
 	})
 
 	return mlFiles, nil
 }
 
-func (s Fabric) Install(useOwnJava bool) error {
+func (s Fabric) Install(javaPath string) error {
+	if s.UseServerLauncher {
+		exists, err := util.PathExists(filepath.Join(s.InstallDir, fabricLaunchJar))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("server launcher %s does not exist", fabricLaunchJar)
+		}
+		pterm.Success.Println("Fabric server launcher installed successfully")
+		return s.StartScript(javaPath)
+	}
+	if err := s.RunInstaller(javaPath); err != nil {
+		return err
+	}
+	return s.StartScript(javaPath)
+}
+
+// RunInstaller runs the Fabric installer, the server launcher has nothing to run
+func (s Fabric) RunInstaller(javaPath string) error {
 	installerName := fmt.Sprintf("fabric-installer-%s.jar", s.FabricInstaller.Version)
 	exists, err := util.PathExists(filepath.Join(s.InstallDir, installerName))
 	if err != nil {
@@ -66,41 +104,59 @@ func (s Fabric) Install(useOwnJava bool) error {
 		return fmt.Errorf("installer %s does not exist", installerName)
 	}
 
-	jrePath := "java"
-	if useOwnJava {
-		jrePath, err = util.GetJavaPath(s.Targets.JavaVersion)
-		if err != nil {
-			jrePath = "java"
-		} else {
-			jrePath = filepath.Join(s.InstallDir, jrePath)
-		}
-	}
+	jrePath := installerJava(s.InstallDir, javaPath)
 
 	pterm.Debug.Printfln("JRE Path: %s", jrePath)
 	cmd := exec.Command(jrePath, "-jar", installerName, "server", "-mcversion", s.Targets.McVersion, "-loader", s.Targets.ModLoader.Version, "-downloadMinecraft")
 	cmd.Dir = s.InstallDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	pterm.Info.Println("Running Fabric installer")
-	if err = cmd.Start(); err != nil {
-		return fmt.Errorf("error running fabric installer: %s", err.Error())
-	}
-	if err = cmd.Wait(); err != nil {
-		if err, ok := err.(*exec.ExitError); ok {
-			if err.ExitCode() != 0 {
-				return fmt.Errorf("fabric installer failed with exit code %d", err.ExitCode())
-			}
-		} else {
-			return fmt.Errorf("error waiting for command: %s", err.Error())
-		}
+	if err = runInstaller("Fabric", cmd); err != nil {
+		return err
 	}
 	pterm.Success.Println("Fabric installed successfully")
 	_ = os.Remove(filepath.Join(s.InstallDir, installerName))
+	return nil
+}
 
-	err = s.startScript(useOwnJava)
+func (s Fabric) RequiresJava() bool {
+	return !s.UseServerLauncher
+}
 
-	return nil
+// getLauncherDownload returns the prebuilt server launcher from fabric meta along with the vanilla
+// server jar, that way the launcher doesn't have to fetch the unverified vanilla jar on first start
+func (s Fabric) getLauncherDownload() ([]structs.File, error) {
+	var mlFiles []structs.File
+
+	// The launcher is built by the meta server on request and there's no checksum published for it, so it's
+	// only used with one the admin pinned
+	if s.LauncherHash == "" {
+		return mlFiles, errors.New("fabric publishes no checksum for its server launcher, pass the sha256 of the launcher with -fabric-launcher-sha256 or use the installer instead")
+	}
+	mlFiles = append(mlFiles, structs.File{
+		Name:               fabricLaunchJar,
+		Url:                s.launcherUrl(),
+		Hash:               s.LauncherHash,
+		HashType:           "sha256",
+		CheckContentLength: true,
+	})
+
+	vanilla, err := GetVanilla(s.Targets, s.InstallDir)
+	if err != nil {
+		return mlFiles, err
+	}
+	vanillaDl, err := vanilla.GetDownload()
+	if err != nil {
+		return mlFiles, err
+	}
+	for _, f := range vanillaDl {
+		f.Name = fabricVanillaJar
+		mlFiles = append(mlFiles, f)
+	}
+
+	return mlFiles, nil
+}
+
+func (s Fabric) launcherUrl() string {
+	return fmt.Sprintf("%s/v2/versions/loader/%s/%s/%s/server/jar", fabricMeta, s.Targets.McVersion, s.Targets.ModLoader.Version, s.FabricInstaller.Version)
 }
 
 func getInstaller() ([]FabricInstaller, error) {
@@ -120,48 +176,13 @@ func getInstaller() ([]FabricInstaller, error) {
 	return fabricInstaller, nil
 }
 
-func (s Fabric) startScript(ownJava bool) error {
-	pterm.Debug.Println("Use own java:", ownJava)
-	var runScriptPath string
-	if runtime.GOOS == "windows" {
-		runScriptPath = filepath.Join(s.InstallDir, "start.bat")
-	}
-	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
-		runScriptPath = filepath.Join(s.InstallDir, "start.sh")
-	}
-	pterm.Debug.Println("runScriptPath:", runScriptPath)
+func (s Fabric) StartScript(javaPath string) error {
+	pterm.Debug.Println("Java path:", javaPath)
 
 	log4jFix, err := Log4JFixer(s.InstallDir, s.Targets.McVersion)
 	if err != nil {
 		pterm.Warning.Printfln("Failed to apply log4j fix: %s", err.Error())
 	}
 
-	runFile, err := os.OpenFile(runScriptPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	if err != nil {
-		return err
-	}
-	defer runFile.Close()
-	javaPath := "java"
-	if ownJava {
-		javaPath, err = util.GetJavaPath(s.Targets.JavaVersion)
-		if err != nil {
-			javaPath = "java"
-		}
-	}
-	runJarName := "fabric-server-launch.jar"
-
-	if runtime.GOOS == "windows" {
-		_, err = runFile.WriteString(fmt.Sprintf("\"%s\" -jar %s -Xmx%dM %s nogui", javaPath, log4jFix, s.Memory.Recommended, runJarName))
-		if err != nil {
-			return err
-		}
-	}
-	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
-		_, err = runFile.WriteString(fmt.Sprintf("#!/usr/bin/env sh\n\"%s\" -jar %s -Xmx%dM %s nogui", javaPath, log4jFix, s.Memory.Recommended, runJarName))
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return writeStartScript(s.InstallDir, javaPath, log4jFix, s.Memory.Recommended, fabricLaunchJar)
 }
@@ -61,16 +61,33 @@ func (s Forge) GetDownload() ([]structs.File, error) {
 		}
 	}
 
+	// The installer is run with java, it has to match the checksum the maven publishes
+	hash, hashType, err := util.MavenChecksum(installerUrl)
+	if err != nil {
+		return mlFiles, err
+	}
 	mlFiles = append(mlFiles, structs.File{
 		Name:               jarName,
 		Url:                installerUrl,
+		Hash:               hash,
+		HashType:           hashType,
 		CheckContentLength: true,
 	})
 	return mlFiles, nil
 }
 
-func (s Forge) Install(useOwnJava bool) error {
+func (s Forge) RequiresJava() bool {
+	return true
+}
+
+func (s Forge) Install(javaPath string) error {
+	if err := s.RunInstaller(javaPath); err != nil {
+		return err
+	}
+	return s.StartScript(javaPath)
+}
 
+func (s Forge) RunInstaller(javaPath string) error {
 	exists, err := util.PathExists(filepath.Join(s.InstallDir, jarName))
 	if err != nil {
 		return err
@@ -80,34 +97,13 @@ func (s Forge) Install(useOwnJava bool) error {
 	}
 
 	if filepath.Ext(jarName) == ".jar" {
-		jrePath := "java"
-		if useOwnJava {
-			jrePath, err = util.GetJavaPath(s.Targets.JavaVersion)
-			if err != nil {
-				jrePath = "java"
-			} else {
-				jrePath = filepath.Join(s.InstallDir, jrePath)
-			}
-		}
+		jrePath := installerJava(s.InstallDir, javaPath)
 
 		pterm.Debug.Printfln("JRE Path: %s", jrePath)
 		cmd := exec.Command(jrePath, "-jar", jarName, "--installServer")
 		cmd.Dir = s.InstallDir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		pterm.Info.Println("Running Forge installer")
-		if err = cmd.Start(); err != nil {
-			return fmt.Errorf("error running forge installer: %s", err.Error())
-		}
-		if err = cmd.Wait(); err != nil {
-			if err, ok := err.(*exec.ExitError); ok {
-				if err.ExitCode() != 0 {
-					return fmt.Errorf("forge installer failed with exit code %d, error: %s", err.ExitCode(), err.Error())
-				}
-			} else {
-				return fmt.Errorf("error waiting for command: %s", err.Error())
-			}
+		if err = runInstaller("Forge", cmd); err != nil {
+			return err
 		}
 		pterm.Success.Println("Forge installed successfully")
 		mcJarWithVer := filepath.Join(s.InstallDir, fmt.Sprintf("minecraft_server.%s.jar", s.Targets.McVersion))
@@ -150,12 +146,6 @@ func (s Forge) Install(useOwnJava bool) error {
 		}
 		_ = os.Remove(filepath.Join(s.InstallDir, jarName))
 	}
-
-	err = s.startScript(useOwnJava)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -168,8 +158,8 @@ func doesForgeExist(url string) bool {
 	return true
 }
 
-func (s Forge) startScript(ownJava bool) error {
-	pterm.Debug.Println("Use own java:", ownJava)
+func (s Forge) StartScript(javaPath string) error {
+	pterm.Debug.Println("Java path:", javaPath)
 	argsFilePath := filepath.Join(s.InstallDir, "user_jvm_args.txt")
 	var runScriptPath string
 	if runtime.GOOS == "windows" {
@@ -230,12 +220,8 @@ func (s Forge) startScript(ownJava bool) error {
 
 			match, _ := regexp.MatchString("^(java).+$", line)
 			if match {
-				if ownJava {
+				if javaPath != "java" {
 					pterm.Debug.Println("Replacing java path in run script")
-					javaPath, err := util.GetJavaPath(s.Targets.JavaVersion)
-					if err != nil {
-						return err
-					}
 					line = regexp.MustCompile("^java").
 						ReplaceAllString(line, fmt.Sprintf("\"%s\"", javaPath))
 				}
@@ -268,13 +254,6 @@ func (s Forge) startScript(ownJava bool) error {
 			return err
 		}
 		defer runFile.Close()
-		javaPath := "java"
-		if ownJava {
-			javaPath, err = util.GetJavaPath(s.Targets.JavaVersion)
-			if err != nil {
-				javaPath = "java"
-			}
-		}
 		dir, err := os.ReadDir(s.InstallDir)
 		if err != nil {
 			return err
@@ -4,5 +4,19 @@ import "ftb-server-downloader/structs"
 
 type ModLoader interface {
 	GetDownload() ([]structs.File, error)
-	Install(useOwnJava bool) error
+	// Install runs the modloader installer with javaPath and writes the start scripts that use it. javaPath is
+	// "java" to use the one on the PATH, a relative path is relative to the install directory.
+	Install(javaPath string) error
+	// RequiresJava reports if Install needs to run java
+	RequiresJava() bool
+}
+
+// Prebuilder is a ModLoader whose installer can be run ahead of time, e.g. while making a bundle, and its output
+// copied into the server later without running the installer again. Install is RunInstaller then StartScript.
+type Prebuilder interface {
+	ModLoader
+	// RunInstaller runs the installer with javaPath, leaving the install directory as the installer wrote it
+	RunInstaller(javaPath string) error
+	// StartScript writes the start scripts that use javaPath for the installer's output
+	StartScript(javaPath string) error
 }
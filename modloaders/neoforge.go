@@ -52,15 +52,32 @@ func (s NeoForge) GetDownload() ([]structs.File, error) {
 		installerUrl = fmt.Sprintf("%s/releases/net/neoforged/forge/%s-%s/forge-%s-%s-installer.jar", neoForgeMaven, s.Targets.McVersion, s.Targets.ModLoader.Version, s.Targets.McVersion, s.Targets.ModLoader.Version)
 	}
 
+	hash, hashType, err := util.MavenChecksum(installerUrl)
+	if err != nil {
+		return mlFiles, err
+	}
 	mlFiles = append(mlFiles, structs.File{
 		Name:               jarName,
 		Url:                installerUrl,
+		Hash:               hash,
+		HashType:           hashType,
 		CheckContentLength: true,
 	})
 	return mlFiles, nil
 }
 
-func (s NeoForge) Install(useOwnJava bool) error {
+func (s NeoForge) RequiresJava() bool {
+	return true
+}
+
+func (s NeoForge) Install(javaPath string) error {
+	if err := s.RunInstaller(javaPath); err != nil {
+		return err
+	}
+	return s.StartScript(javaPath)
+}
+
+func (s NeoForge) RunInstaller(javaPath string) error {
 	installerName := fmt.Sprintf("neoforge-%s-installer.jar", s.Targets.ModLoader.Version)
 	if !s.IsAfterSplit {
 		installerName = fmt.Sprintf("forge-%s-%s-installer.jar", s.Targets.McVersion, s.Targets.ModLoader.Version)
@@ -73,49 +90,22 @@ func (s NeoForge) Install(useOwnJava bool) error {
 		return fmt.Errorf("installer %s does not exist", installerName)
 	}
 
-	jrePath := "java"
-	if useOwnJava {
-		jrePath, err = util.GetJavaPath(s.Targets.JavaVersion)
-		if err != nil {
-			jrePath = "java"
-		} else {
-			jrePath = filepath.Join(s.InstallDir, jrePath)
-		}
-	}
+	jrePath := installerJava(s.InstallDir, javaPath)
 
 	pterm.Debug.Printfln("JRE Path: %s", jrePath)
 	cmd := exec.Command(jrePath, "-jar", installerName, "--installServer")
 	cmd.Dir = s.InstallDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	pterm.Info.Println("Running NeoForge installer")
-	if err = cmd.Start(); err != nil {
-		return fmt.Errorf("error running neoforge installer: %s", err.Error())
-	}
-	if err = cmd.Wait(); err != nil {
-		// Todo test this with errors.As
-		if err, ok := err.(*exec.ExitError); ok {
-			if err.ExitCode() != 0 {
-				return fmt.Errorf("neoforge installer failed with exit code %d", err.ExitCode())
-			}
-		} else {
-			return fmt.Errorf("error waiting for command: %s", err.Error())
-		}
+	if err = runInstaller("NeoForge", cmd); err != nil {
+		return err
 	}
 	pterm.Success.Println("NeoForge installed successfully")
 	// _ = os.Remove(filepath.Join(s.InstallDir, installerName) + ".log")
 	_ = os.Remove(filepath.Join(s.InstallDir, installerName))
-
-	err = s.startScript(useOwnJava)
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
-func (s NeoForge) startScript(ownJava bool) error {
-	pterm.Debug.Println("Use own java:", ownJava)
+func (s NeoForge) StartScript(javaPath string) error {
+	pterm.Debug.Println("Java path:", javaPath)
 	argsFilePath := filepath.Join(s.InstallDir, "user_jvm_args.txt")
 	var runScriptPath string
 	if runtime.GOOS == "windows" {
@@ -171,12 +161,8 @@ func (s NeoForge) startScript(ownJava bool) error {
 
 			match, _ := regexp.MatchString("^(exec )?java.+$", line)
 			if match {
-				if ownJava {
+				if javaPath != "java" {
 					pterm.Debug.Println("Replacing java path in run script")
-					javaPath, err := util.GetJavaPath(s.Targets.JavaVersion)
-					if err != nil {
-						return err
-					}
 					line = regexp.MustCompile("^(exec )?java").
 						ReplaceAllStringFunc(line, func(m string) string {
 							if strings.HasPrefix(m, "exec ") {
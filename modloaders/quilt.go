@@ -0,0 +1,131 @@
+package modloaders
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"ftb-server-downloader/util"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pterm/pterm"
+)
+
+const quiltMeta = "https://meta.quiltmc.org"
+
+type Quilt struct {
+	InstallDir     string
+	Targets        structs.ModpackTargets
+	Memory         structs.Memory
+	QuiltInstaller QuiltInstaller
+}
+
+type QuiltInstaller struct {
+	URL     string `json:"url"`
+	Maven   string `json:"maven"`
+	Version string `json:"version"`
+}
+
+func GetQuilt(target structs.ModpackTargets, memory structs.Memory, installDir string) (Quilt, error) {
+	quiltInstaller, err := getQuiltInstaller()
+	if err != nil {
+		return Quilt{}, err
+	}
+	if len(quiltInstaller) == 0 {
+		return Quilt{}, errors.New("no quilt installer versions found")
+	}
+
+	return Quilt{
+		InstallDir:     installDir,
+		Targets:        target,
+		Memory:         memory,
+		QuiltInstaller: quiltInstaller[0],
+	}, nil
+}
+
+func (s Quilt) GetDownload() ([]structs.File, error) {
+	var mlFiles []structs.File
+
+	hash, hashType, err := util.MavenChecksum(s.QuiltInstaller.URL)
+	if err != nil {
+		return mlFiles, err
+	}
+	mlFiles = append(mlFiles, structs.File{
+		Name:               s.installerName(),
+		Url:                s.QuiltInstaller.URL,
+		Hash:               hash,
+		HashType:           hashType,
+		CheckContentLength: true,
+	})
+
+	return mlFiles, nil
+}
+
+func (s Quilt) RequiresJava() bool {
+	return true
+}
+
+func (s Quilt) Install(javaPath string) error {
+	if err := s.RunInstaller(javaPath); err != nil {
+		return err
+	}
+	return s.StartScript(javaPath)
+}
+
+func (s Quilt) RunInstaller(javaPath string) error {
+	installerName := s.installerName()
+	exists, err := util.PathExists(filepath.Join(s.InstallDir, installerName))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("installer %s does not exist", installerName)
+	}
+
+	jrePath := installerJava(s.InstallDir, javaPath)
+
+	pterm.Debug.Printfln("JRE Path: %s", jrePath)
+	// --download-server is the quilt equivalent of fabric's -downloadMinecraft
+	cmd := exec.Command(jrePath, "-jar", installerName, "install", "server", s.Targets.McVersion, s.Targets.ModLoader.Version, "--download-server", "--install-dir=.")
+	cmd.Dir = s.InstallDir
+	if err = runInstaller("Quilt", cmd); err != nil {
+		return err
+	}
+	pterm.Success.Println("Quilt installed successfully")
+	_ = os.Remove(filepath.Join(s.InstallDir, installerName))
+	return nil
+}
+
+func (s Quilt) installerName() string {
+	return fmt.Sprintf("quilt-installer-%s.jar", s.QuiltInstaller.Version)
+}
+
+func getQuiltInstaller() ([]QuiltInstaller, error) {
+	url := fmt.Sprintf("%s/v3/versions/installer", quiltMeta)
+	resp, err := util.DoGet(url)
+	if err != nil {
+		return []QuiltInstaller{}, err
+	}
+	defer resp.Body.Close()
+	var quiltInstaller []QuiltInstaller
+
+	err = json.NewDecoder(resp.Body).Decode(&quiltInstaller)
+	if err != nil {
+		return []QuiltInstaller{}, err
+	}
+
+	return quiltInstaller, nil
+}
+
+func (s Quilt) StartScript(javaPath string) error {
+	pterm.Debug.Println("Java path:", javaPath)
+
+	log4jFix, err := Log4JFixer(s.InstallDir, s.Targets.McVersion)
+	if err != nil {
+		pterm.Warning.Printfln("Failed to apply log4j fix: %s", err.Error())
+	}
+
+	return writeStartScript(s.InstallDir, javaPath, log4jFix, s.Memory.Recommended, "quilt-server-launch.jar")
+}
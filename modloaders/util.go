@@ -1,11 +1,15 @@
 package modloaders
 
 import (
+	"errors"
 	"fmt"
 	"ftb-server-downloader/util"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	semVer "github.com/hashicorp/go-version"
 	"github.com/pterm/pterm"
@@ -79,3 +83,72 @@ func Log4JFixer(installDir string, mcVersion string) (string, error) {
 
 	return "", nil
 }
+
+// installerJava is the java to run an installer with, a relative javaPath is joined to the install directory
+func installerJava(installDir string, javaPath string) string {
+	if javaPath == "java" || filepath.IsAbs(javaPath) {
+		return javaPath
+	}
+	return filepath.Join(installDir, javaPath)
+}
+
+// writeStartScript writes a start.sh/start.bat that launches runJarName, used by loaders that don't
+// generate their own run scripts
+func writeStartScript(installDir string, javaPath string, log4jFix string, memory int, runJarName string) error {
+	var runScriptPath string
+	if runtime.GOOS == "windows" {
+		runScriptPath = filepath.Join(installDir, "start.bat")
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
+		runScriptPath = filepath.Join(installDir, "start.sh")
+	}
+	pterm.Debug.Println("runScriptPath:", runScriptPath)
+
+	runFile, err := os.OpenFile(runScriptPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer runFile.Close()
+
+	javaArgs := strings.TrimSpace(fmt.Sprintf("-Xmx%dM %s", memory, log4jFix))
+	if runtime.GOOS == "windows" {
+		_, err = runFile.WriteString(fmt.Sprintf("\"%s\" %s -jar %s nogui", javaPath, javaArgs, runJarName))
+		if err != nil {
+			return err
+		}
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
+		_, err = runFile.WriteString(fmt.Sprintf("#!/usr/bin/env sh\n\"%s\" %s -jar %s nogui", javaPath, javaArgs, runJarName))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runInstaller runs a modloader installer command and reports it in the event stream
+func runInstaller(name string, cmd *exec.Cmd) error {
+	cmd.Stdout = util.CmdOutput
+	cmd.Stderr = os.Stderr
+
+	util.Emit(util.EventModloaderStart, util.ModloaderEvent{Name: name})
+	pterm.Info.Printfln("Running %s installer", name)
+	if err := cmd.Start(); err != nil {
+		util.Emit(util.EventModloaderExit, util.ModloaderEvent{Name: name, ExitCode: -1})
+		return fmt.Errorf("error running %s installer: %s", strings.ToLower(name), err.Error())
+	}
+	err := cmd.Wait()
+	util.Emit(util.EventModloaderExit, util.ModloaderEvent{Name: name, ExitCode: cmd.ProcessState.ExitCode()})
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if exitErr.ExitCode() != 0 {
+				return fmt.Errorf("%s installer failed with exit code %d", strings.ToLower(name), exitErr.ExitCode())
+			}
+		} else {
+			return fmt.Errorf("error waiting for command: %s", err.Error())
+		}
+	}
+	return nil
+}
@@ -69,15 +69,20 @@ func (v Vanilla) GetDownload() ([]structs.File, error) {
 		Url:      version.Downloads.Server.URL,
 		Hash:     version.Downloads.Server.Sha1,
 		HashType: "sha1",
+		Size:     int64(version.Downloads.Server.Size),
 	})
 
 	return mlFiles, nil
 }
 
-func (v Vanilla) Install(bool) error {
+func (v Vanilla) Install(string) error {
 	return nil
 }
 
+func (v Vanilla) RequiresJava() bool {
+	return false
+}
+
 type LauncherMeta struct {
 	Latest   VanillaLatest     `json:"latest"`
 	Versions []VanillaVersions `json:"versions"`
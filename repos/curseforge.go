@@ -1,21 +1,41 @@
 package repos
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"ftb-server-downloader/structs"
+	"ftb-server-downloader/util"
+	"io/fs"
+	"os"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/pterm/pterm"
 )
 
-const (
+var (
+	// cfAPIUrl is a var so tests can point the provider at a local stand-in server
 	cfAPIUrl = "https://api.curseforge.com"
 )
 
+const (
+	cfManifestName = "manifest.json"
+	cfPageSize     = 50
+	cfHashSha1     = 1
+	cfClassRPack   = 12
+	cfClassShade   = 6552
+)
+
 type CurseForge struct {
 	PackId    int
 	VersionId int
 }
 
-//goland:noinspection GoUnusedExportedFunction
 func GetCurseForge(packId, versionId int) *CurseForge {
 	return &CurseForge{
 		PackId:    packId,
@@ -24,13 +44,89 @@ func GetCurseForge(packId, versionId int) *CurseForge {
 }
 
 func (v *CurseForge) GetModpack() (structs.Modpack, error) {
-	pterm.Info.Printfln("Getting modpack with id %d from CurseForge", v.PackId)
-	return structs.Modpack{}, nil
+	url := fmt.Sprintf("%s/v1/mods/%d", cfAPIUrl, v.PackId)
+	pterm.Debug.Printfln("Getting modpack from curseforge using %s", url)
+
+	var cfMod structs.CFModResponse
+	if err := cfGet(url, &cfMod); err != nil {
+		return structs.Modpack{}, err
+	}
+
+	var versionList []structs.ModpackV
+	index := 0
+	for {
+		url = fmt.Sprintf("%s/v1/mods/%d/files?index=%d&pageSize=%d", cfAPIUrl, v.PackId, index, cfPageSize)
+		var cfFiles structs.CFFilesResponse
+		if err := cfGet(url, &cfFiles); err != nil {
+			return structs.Modpack{}, err
+		}
+
+		for _, f := range cfFiles.Data {
+			// Server packs are listed alongside the normal pack files, they are not versions in their own right
+			if f.IsServerPack {
+				continue
+			}
+			versionList = append(versionList, structs.ModpackV{
+				Id:   f.ID,
+				Type: cfReleaseType(f.ReleaseType),
+			})
+		}
+
+		index += cfPageSize
+		if len(cfFiles.Data) == 0 || index >= cfFiles.Pagination.TotalCount {
+			break
+		}
+	}
+
+	sort.Slice(versionList, func(i, j int) bool {
+		return versionList[i].Id > versionList[j].Id
+	})
+
+	return structs.Modpack{
+		Name:     cfMod.Data.Name,
+		Id:       cfMod.Data.ID,
+		Versions: versionList,
+	}, nil
 }
 
 func (v *CurseForge) GetVersion() (structs.ModpackVersion, error) {
-	pterm.Info.Printfln("Getting modpack version with id %d from CurseForge", v.PackId)
-	return structs.ModpackVersion{}, nil
+	url := fmt.Sprintf("%s/v1/mods/%d/files/%d", cfAPIUrl, v.PackId, v.VersionId)
+	pterm.Debug.Printfln("Getting modpack version from curseforge using %s", url)
+
+	var cfFile structs.CFFileResponse
+	if err := cfGet(url, &cfFile); err != nil {
+		return structs.ModpackVersion{}, err
+	}
+	if cfFile.Data.IsServerPack {
+		// Server packs are a zip of whatever the author's server had, there's no manifest to install or update from
+		return structs.ModpackVersion{}, fmt.Errorf("file %d is a server pack, server packs can't be installed, please use the id of the modpack version it belongs to instead", cfFile.Data.ID)
+	}
+
+	manifest, archive, err := v.getManifest(cfFile.Data)
+	if err != nil {
+		return structs.ModpackVersion{}, err
+	}
+
+	targets, err := parseCFTargets(manifest.Minecraft)
+	if err != nil {
+		_ = os.Remove(archive)
+		return structs.ModpackVersion{}, err
+	}
+
+	files, err := getCFFiles(manifest.Files)
+	if err != nil {
+		_ = os.Remove(archive)
+		return structs.ModpackVersion{}, err
+	}
+
+	return structs.ModpackVersion{
+		Id:        cfFile.Data.ID,
+		Name:      cfFile.Data.DisplayName,
+		Targets:   targets,
+		Memory:    defaultMemory,
+		Files:     files,
+		Overrides: cfOverrides(archive, manifest, true),
+	}, nil
 }
 
 func (v *CurseForge) SetVersionId(versionId int) {
@@ -44,3 +140,249 @@ func (v *CurseForge) SuccessfulInstall() {
 func (v *CurseForge) FailedInstall() {
 	return
 }
+
+// getManifest downloads the modpack archive and reads the manifest.json from it, the archive is
+// kept so the overrides can be copied once the pack files have been downloaded
+func (v *CurseForge) getManifest(packFile structs.CFFile) (structs.CFManifest, string, error) {
+	if packFile.DownloadURL == "" {
+		return structs.CFManifest{}, "", fmt.Errorf("the author of %s has opted out of third party downloads, it can only be installed from CurseForge", packFile.DisplayName)
+	}
+	tmpFile, err := os.CreateTemp("", "ftb-cf-pack-*.zip")
+	if err != nil {
+		return structs.CFManifest{}, "", err
+	}
+	_ = tmpFile.Close()
+
+	manifest, err := func() (structs.CFManifest, error) {
+		dl, err := util.NewDownload(tmpFile.Name(), packFile.DownloadURL)
+		if err != nil {
+			return structs.CFManifest{}, err
+		}
+		if hash := cfSha1(packFile.Hashes); hash != "" {
+			hexHash, _ := hex.DecodeString(hash)
+			dl.SetChecksum(sha1.New(), hexHash, true)
+		}
+		if err = dl.Do(); err != nil {
+			return structs.CFManifest{}, fmt.Errorf("unable to download modpack archive: %s", err.Error())
+		}
+
+		packFS, closeFS, err := util.OpenPackFS(tmpFile.Name())
+		if err != nil {
+			return structs.CFManifest{}, err
+		}
+		defer closeFS()
+		return readCFManifest(packFS)
+	}()
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return structs.CFManifest{}, "", err
+	}
+	return manifest, tmpFile.Name(), nil
+}
+
+func readCFManifest(packFS fs.FS) (structs.CFManifest, error) {
+	manifestFile, err := packFS.Open(cfManifestName)
+	if err != nil {
+		return structs.CFManifest{}, fmt.Errorf("modpack does not contain a %s: %s", cfManifestName, err.Error())
+	}
+	defer manifestFile.Close()
+
+	var manifest structs.CFManifest
+	if err = json.NewDecoder(manifestFile).Decode(&manifest); err != nil {
+		return structs.CFManifest{}, err
+	}
+	return manifest, nil
+}
+
+// cfOverrides returns the overrides for a manifest.json inside source
+func cfOverrides(source string, manifest structs.CFManifest, temporary bool) structs.Overrides {
+	dir := manifest.Overrides
+	if dir == "" {
+		dir = "overrides"
+	}
+	return structs.Overrides{
+		Source:    source,
+		Dirs:      []string{dir},
+		Temporary: temporary,
+	}
+}
+
+// getCFFiles resolves the file list from a manifest.json into downloadable files
+func getCFFiles(manifestFiles []structs.CFManifestFile) ([]structs.File, error) {
+	var fileIds, modIds []int
+	for _, f := range manifestFiles {
+		if !f.Required {
+			continue
+		}
+		fileIds = append(fileIds, f.FileID)
+		modIds = append(modIds, f.ProjectID)
+	}
+	if len(fileIds) == 0 {
+		return []structs.File{}, nil
+	}
+
+	var cfFiles structs.CFFilesResponse
+	if err := cfPost(fmt.Sprintf("%s/v1/mods/files", cfAPIUrl), map[string][]int{"fileIds": fileIds}, &cfFiles); err != nil {
+		return nil, err
+	}
+	var cfMods structs.CFModsResponse
+	if err := cfPost(fmt.Sprintf("%s/v1/mods", cfAPIUrl), map[string][]int{"modIds": modIds}, &cfMods); err != nil {
+		return nil, err
+	}
+
+	// Files that were deleted or hidden are left out of the response, the pack would be missing those mods
+	returned := map[int]bool{}
+	for _, f := range cfFiles.Data {
+		returned[f.ID] = true
+	}
+	var missing []string
+	for i, id := range fileIds {
+		if !returned[id] {
+			missing = append(missing, fmt.Sprintf("project %d file %d", modIds[i], id))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%d files in the modpack no longer exist on CurseForge:\n  %s", len(missing), strings.Join(missing, "\n  "))
+	}
+
+	mods := map[int]structs.CFMod{}
+	for _, m := range cfMods.Data {
+		mods[m.ID] = m
+	}
+
+	return parseCFFiles(cfFiles.Data, mods)
+}
+
+func parseCFTargets(minecraft structs.CFManifestMinecraft) (structs.ModpackTargets, error) {
+	var modpackTargets structs.ModpackTargets
+	modpackTargets.McVersion = minecraft.Version
+
+	for _, ml := range minecraft.ModLoaders {
+		if !ml.Primary && len(minecraft.ModLoaders) > 1 {
+			continue
+		}
+		loader, err := parseLoaderId(ml.ID)
+		if err != nil {
+			return structs.ModpackTargets{}, err
+		}
+		modpackTargets.ModLoader = loader
+		break
+	}
+	if modpackTargets.ModLoader.Name == "" {
+		return structs.ModpackTargets{}, errors.New("no modloader found in manifest.json")
+	}
+
+	javaVersion, err := javaVersionForMinecraft(minecraft.Version)
+	if err != nil {
+		return structs.ModpackTargets{}, err
+	}
+	modpackTargets.JavaVersion = javaVersion
+
+	return modpackTargets, nil
+}
+
+// parseCFFiles turns the files of a pack into downloads, failing with the list of files that have to be
+// downloaded by hand if any of their authors opted out of third party distribution
+func parseCFFiles(files []structs.CFFile, mods map[int]structs.CFMod) ([]structs.File, error) {
+	var parsedFiles []structs.File
+	var optedOut []string
+	for _, f := range files {
+		// Files only tagged for the client are the CurseForge equivalent of FTB's clientonly flag
+		if slices.Contains(f.GameVersions, "Client") && !slices.Contains(f.GameVersions, "Server") {
+			continue
+		}
+		// The API leaves the download url out when the author doesn't allow third party downloads
+		if f.DownloadURL == "" {
+			name := mods[f.ModID].Slug
+			if name == "" {
+				name = fmt.Sprintf("project %d", f.ModID)
+			}
+			optedOut = append(optedOut, fmt.Sprintf("%s from %s (file %d)", f.FileName, name, f.ID))
+			continue
+		}
+
+		dir := "mods"
+		switch mods[f.ModID].ClassID {
+		case cfClassRPack:
+			dir = "resourcepacks"
+		case cfClassShade:
+			dir = "shaderpacks"
+		}
+
+		parsedFiles = append(parsedFiles, structs.File{
+			Name:     f.FileName,
+			Path:     dir,
+			Url:      f.DownloadURL,
+			Hash:     cfSha1(f.Hashes),
+			HashType: "sha1",
+			Size:     f.FileLength,
+		})
+	}
+	if len(optedOut) > 0 {
+		return nil, fmt.Errorf("the authors of %d files have opted out of third party downloads, download them from CurseForge and put them in the server by hand:\n  %s", len(optedOut), strings.Join(optedOut, "\n  "))
+	}
+	return parsedFiles, nil
+}
+
+func cfSha1(hashes []structs.CFHash) string {
+	for _, h := range hashes {
+		if h.Algo == cfHashSha1 {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func cfReleaseType(releaseType int) string {
+	switch releaseType {
+	case 1:
+		return "release"
+	case 2:
+		return "beta"
+	case 3:
+		return "alpha"
+	default:
+		return "unknown"
+	}
+}
+
+func cfHeaders() (map[string][]string, error) {
+	if util.CfApiKey == "" && !util.Replaying() {
+		return nil, errors.New("no CurseForge API key set, set the CURSEFORGE_API_KEY environment variable")
+	}
+	return map[string][]string{
+		"x-api-key":    {util.CfApiKey},
+		"Accept":       {"application/json"},
+		"Content-Type": {"application/json"},
+	}, nil
+}
+
+func cfGet(url string, out any) error {
+	headers, err := cfHeaders()
+	if err != nil {
+		return err
+	}
+	resp, err := util.DoGetWithHeaders(url, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func cfPost(url string, body any, out any) error {
+	headers, err := cfHeaders()
+	if err != nil {
+		return err
+	}
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := util.DoPost(url, headers, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
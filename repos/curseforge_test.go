@@ -0,0 +1,254 @@
+package repos
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"ftb-server-downloader/util"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newCurseForgeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var packZip bytes.Buffer
+	zw := zip.NewWriter(&packZip)
+	w, _ := zw.Create("manifest.json")
+	_ = json.NewEncoder(w).Encode(structs.CFManifest{
+		Minecraft: structs.CFManifestMinecraft{
+			Version:    "1.20.1",
+			ModLoaders: []structs.CFManifestModLoader{{ID: "forge-47.2.0", Primary: true}},
+		},
+		ManifestType: "minecraftModpack",
+		Files: []structs.CFManifestFile{
+			{ProjectID: 10, FileID: 1001, Required: true},
+			{ProjectID: 11, FileID: 1101, Required: true},
+			{ProjectID: 12, FileID: 1201, Required: true},
+			{ProjectID: 13, FileID: 1301, Required: false},
+		},
+		Overrides: "overrides",
+	})
+	_ = zw.Close()
+	packSha1 := fmt.Sprintf("%x", sha1.Sum(packZip.Bytes()))
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+
+	writeJson := func(w http.ResponseWriter, r *http.Request, v any) {
+		if r.Header.Get("x-api-key") != "test-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	mux.HandleFunc("GET /v1/mods/1", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, r, structs.CFModResponse{Data: structs.CFMod{ID: 1, Name: "Test Pack"}})
+	})
+	mux.HandleFunc("GET /v1/mods/1/files", func(w http.ResponseWriter, r *http.Request) {
+		var data []structs.CFFile
+		if r.URL.Query().Get("index") == "0" {
+			data = []structs.CFFile{{ID: 100, ReleaseType: 1}, {ID: 101, IsServerPack: true}}
+		} else {
+			data = []structs.CFFile{{ID: 200, ReleaseType: 2}}
+		}
+		writeJson(w, r, structs.CFFilesResponse{Data: data, Pagination: structs.CFPagination{TotalCount: 51}})
+	})
+	mux.HandleFunc("GET /v1/mods/1/files/200", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, r, structs.CFFileResponse{Data: structs.CFFile{
+			ID:          200,
+			DisplayName: "Test Pack 1.0.0",
+			DownloadURL: srv.URL + "/pack.zip",
+			Hashes:      []structs.CFHash{{Value: packSha1, Algo: 1}},
+		}})
+	})
+	mux.HandleFunc("GET /pack.zip", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(packZip.Bytes())
+	})
+	mux.HandleFunc("POST /v1/mods/files", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, r, structs.CFFilesResponse{Data: []structs.CFFile{
+			{ID: 1001, ModID: 10, FileName: "mod.jar", DownloadURL: "https://edge.forgecdn.net/files/1/1/mod.jar", Hashes: []structs.CFHash{{Value: "aa", Algo: 2}, {Value: "bb", Algo: 1}}},
+			{ID: 1101, ModID: 11, FileName: "client.jar", GameVersions: []string{"1.20.1", "Client"}},
+			{ID: 1201, ModID: 12, FileName: "textures.zip", DownloadURL: "https://edge.forgecdn.net/files/1/201/textures.zip"},
+		}})
+	})
+	mux.HandleFunc("POST /v1/mods", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, r, structs.CFModsResponse{Data: []structs.CFMod{{ID: 10, ClassID: 6}, {ID: 11, ClassID: 6}, {ID: 12, ClassID: 12}}})
+	})
+
+	return srv
+}
+
+func TestCurseForge(t *testing.T) {
+	srv := newCurseForgeServer(t)
+	defer srv.Close()
+
+	oldUrl, oldKey := cfAPIUrl, util.CfApiKey
+	cfAPIUrl, util.CfApiKey = srv.URL, "test-key"
+	defer func() { cfAPIUrl, util.CfApiKey = oldUrl, oldKey }()
+
+	cf := GetCurseForge(1, 0)
+	modpack, err := cf.GetModpack()
+	if err != nil {
+		t.Fatalf("GetModpack: %s", err)
+	}
+	if modpack.Name != "Test Pack" || len(modpack.Versions) != 2 {
+		t.Fatalf("got %+v, want 2 versions of Test Pack", modpack)
+	}
+	if modpack.Versions[0].Id != 200 || modpack.Versions[0].Type != "beta" {
+		t.Errorf("got latest version %+v, want 200 (beta)", modpack.Versions[0])
+	}
+
+	cf.SetVersionId(200)
+	version, err := cf.GetVersion()
+	if err != nil {
+		t.Fatalf("GetVersion: %s", err)
+	}
+	if version.Targets.ModLoader.Name != "forge" || version.Targets.ModLoader.Version != "47.2.0" {
+		t.Errorf("got modloader %+v, want forge 47.2.0", version.Targets.ModLoader)
+	}
+	if version.Targets.JavaVersion != "17" {
+		t.Errorf("got java %s, want 17", version.Targets.JavaVersion)
+	}
+
+	want := []structs.File{
+		{Name: "mod.jar", Path: "mods", Url: "https://edge.forgecdn.net/files/1/1/mod.jar", Hash: "bb", HashType: "sha1"},
+		{Name: "textures.zip", Path: "resourcepacks", Url: "https://edge.forgecdn.net/files/1/201/textures.zip", HashType: "sha1"},
+	}
+	if len(version.Files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(version.Files), len(want), version.Files)
+	}
+	for i, f := range want {
+		got := version.Files[i]
+		if got.Name != f.Name || got.Path != f.Path || got.Url != f.Url || got.Hash != f.Hash || got.HashType != f.HashType {
+			t.Errorf("got file %+v, want %+v", got, f)
+		}
+	}
+}
+
+func TestCurseForgeNoApiKey(t *testing.T) {
+	oldKey := util.CfApiKey
+	util.CfApiKey = ""
+	defer func() { util.CfApiKey = oldKey }()
+
+	if _, err := GetCurseForge(1, 0).GetModpack(); err == nil {
+		t.Error("expected an error without an api key")
+	}
+}
+
+func TestCurseForgeOptedOut(t *testing.T) {
+	files := []structs.CFFile{
+		{ID: 1001, ModID: 10, FileName: "mod.jar", DownloadURL: "https://edge.forgecdn.net/files/1/1/mod.jar"},
+		{ID: 1101, ModID: 11, FileName: "client.jar", GameVersions: []string{"Client"}},
+		{ID: 1201, ModID: 12, FileName: "optedout.jar"},
+	}
+	mods := map[int]structs.CFMod{12: {ID: 12, Slug: "opted-out-mod"}}
+
+	_, err := parseCFFiles(files, mods)
+	if err == nil {
+		t.Fatal("expected an error for a file without a download url")
+	}
+	if !strings.Contains(err.Error(), "optedout.jar from opted-out-mod (file 1201)") || strings.Contains(err.Error(), "client.jar") {
+		t.Errorf("error doesn't list just the opted out server file: %s", err)
+	}
+}
+
+func TestCurseForgeMissingFiles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/mods/files" {
+			_ = json.NewEncoder(w).Encode(structs.CFFilesResponse{Data: []structs.CFFile{{ID: 1001, ModID: 10, FileName: "mod.jar", DownloadURL: "https://edge.forgecdn.net/files/1/1/mod.jar"}}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(structs.CFModsResponse{Data: []structs.CFMod{{ID: 10, ClassID: 6}, {ID: 11, ClassID: 6}}})
+	}))
+	defer srv.Close()
+
+	oldUrl, oldKey := cfAPIUrl, util.CfApiKey
+	cfAPIUrl, util.CfApiKey = srv.URL, "test-key"
+	defer func() { cfAPIUrl, util.CfApiKey = oldUrl, oldKey }()
+
+	_, err := getCFFiles([]structs.CFManifestFile{
+		{ProjectID: 10, FileID: 1001, Required: true},
+		{ProjectID: 11, FileID: 1101, Required: true},
+	})
+	if err == nil {
+		t.Fatal("expected an error when a file isn't returned")
+	}
+	if !strings.Contains(err.Error(), "project 11 file 1101") {
+		t.Errorf("error doesn't list the missing file: %s", err)
+	}
+}
+
+func TestCurseForgeBundle(t *testing.T) {
+	srv := newCurseForgeServer(t)
+	defer srv.Close()
+
+	oldUrl, oldKey := cfAPIUrl, util.CfApiKey
+	cfAPIUrl, util.CfApiKey = srv.URL, "test-key"
+	defer func() {
+		cfAPIUrl, util.CfApiKey = oldUrl, oldKey
+		_ = util.SetHTTPOptions(util.DefaultHTTPOptions)
+	}()
+
+	resolve := func() structs.ModpackVersion {
+		t.Helper()
+		cf := GetCurseForge(1, 200)
+		if _, err := cf.GetModpack(); err != nil {
+			t.Fatalf("GetModpack: %s", err)
+		}
+		version, err := cf.GetVersion()
+		if err != nil {
+			t.Fatalf("GetVersion: %s", err)
+		}
+		if version.Overrides.Temporary {
+			_ = os.Remove(version.Overrides.Source)
+		}
+		return version
+	}
+
+	dir := t.TempDir()
+	recorder, err := util.NewResponseRecorder(filepath.Join(dir, "content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = util.SetHTTPOptions(util.HTTPOptions{Record: recorder}); err != nil {
+		t.Fatal(err)
+	}
+	recorded := resolve()
+
+	out := filepath.Join(dir, "bundle.tar.zst")
+	manifest := structs.BundleManifest{Format: util.BundleFormat, Provider: "curseforge", Responses: recorder.Responses()}
+	if err = util.WriteBundle(out, recorder.Dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	// The install from the bundle has neither network access nor an API key
+	bundle, err := util.OpenBundle(out, filepath.Join(dir, "extracted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = util.SetHTTPOptions(util.HTTPOptions{Replay: bundle}); err != nil {
+		t.Fatal(err)
+	}
+	util.CfApiKey = ""
+	replayed := resolve()
+
+	if len(replayed.Files) != len(recorded.Files) || len(replayed.Files) == 0 {
+		t.Fatalf("replayed %d files, recorded %d", len(replayed.Files), len(recorded.Files))
+	}
+	for i := range recorded.Files {
+		if !reflect.DeepEqual(replayed.Files[i], recorded.Files[i]) {
+			t.Errorf("replayed file %+v, recorded %+v", replayed.Files[i], recorded.Files[i])
+		}
+	}
+}
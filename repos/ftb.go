@@ -165,6 +165,7 @@ func parseFTBFiles(files []structs.FTBFiles) []structs.File {
 				Url:      f.URL,
 				Hash:     f.Sha1,
 				HashType: "sha1",
+				Size:     int64(f.Size),
 				Mirrors:  f.Mirrors,
 			})
 		}
@@ -0,0 +1,215 @@
+package repos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"ftb-server-downloader/util"
+	"hash/fnv"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+const ftbVersionName = "version.json"
+
+// Local installs a modpack from an archive or directory on disk instead of a modpack API. It understands
+// CurseForge manifest.json, Modrinth modrinth.index.json and FTB version json files.
+type Local struct {
+	Source    string
+	VersionId int
+	loaded    bool
+	modpack   structs.Modpack
+	version   structs.ModpackVersion
+}
+
+// localProbe is used to work out which kind of modpack json we have been given
+type localProbe struct {
+	ManifestType  string               `json:"manifestType"`
+	FormatVersion int                  `json:"formatVersion"`
+	Dependencies  map[string]string    `json:"dependencies"`
+	Targets       []structs.FTBTargets `json:"targets"`
+}
+
+func GetLocal(source string, versionId int) *Local {
+	return &Local{
+		Source:    source,
+		VersionId: versionId,
+	}
+}
+
+func (l *Local) GetModpack() (structs.Modpack, error) {
+	if err := l.load(); err != nil {
+		return structs.Modpack{}, err
+	}
+	return l.modpack, nil
+}
+
+func (l *Local) GetVersion() (structs.ModpackVersion, error) {
+	if err := l.load(); err != nil {
+		return structs.ModpackVersion{}, err
+	}
+	if l.VersionId != 0 && l.VersionId != l.version.Id {
+		return structs.ModpackVersion{}, fmt.Errorf("version %d not found in %s, it contains version %d", l.VersionId, l.Source, l.version.Id)
+	}
+	return l.version, nil
+}
+
+func (l *Local) SetVersionId(versionId int) {
+	l.VersionId = versionId
+}
+
+func (l *Local) SuccessfulInstall() {
+	return
+}
+
+func (l *Local) FailedInstall() {
+	return
+}
+
+func (l *Local) load() error {
+	if l.loaded {
+		return nil
+	}
+
+	info, err := os.Stat(l.Source)
+	if err != nil {
+		return fmt.Errorf("unable to read modpack source: %s", err.Error())
+	}
+
+	// A lone json file, its overrides (if any) live next to it
+	if !info.IsDir() && strings.EqualFold(filepath.Ext(l.Source), ".json") {
+		pterm.Debug.Printfln("Reading local modpack json %s", l.Source)
+		data, err := os.ReadFile(l.Source)
+		if err != nil {
+			return err
+		}
+		if err = l.parse(data, filepath.Dir(l.Source)); err != nil {
+			return err
+		}
+		l.loaded = true
+		return nil
+	}
+
+	packFS, closeFS, err := util.OpenPackFS(l.Source)
+	if err != nil {
+		return err
+	}
+	defer closeFS()
+
+	for _, name := range []string{mrIndexName, cfManifestName, ftbVersionName} {
+		data, err := fs.ReadFile(packFS, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pterm.Debug.Printfln("Found %s in %s", name, l.Source)
+		if err = l.parse(data, l.Source); err != nil {
+			return err
+		}
+		l.loaded = true
+		return nil
+	}
+
+	return fmt.Errorf("no %s, %s or %s found in %s", mrIndexName, cfManifestName, ftbVersionName, l.Source)
+}
+
+// parse fills in the modpack and version from a modpack json, overridesSource is where the
+// override folders for the pack can be found
+func (l *Local) parse(data []byte, overridesSource string) error {
+	var probe localProbe
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return fmt.Errorf("unable to parse modpack json: %s", err.Error())
+	}
+
+	// CurseForge and Modrinth packs don't carry a numeric id, so the pack name is hashed for the id and the
+	// pack json for the version. The same pack json is the same version wherever it's copied to, and any
+	// change to it is a new one, see localContentId
+	switch {
+	case probe.ManifestType != "":
+		var manifest structs.CFManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return err
+		}
+		targets, err := parseCFTargets(manifest.Minecraft)
+		if err != nil {
+			return err
+		}
+		// The manifest only has the project and file ids, the files are looked up with the CurseForge API
+		if util.CfApiKey == "" && !util.Replaying() {
+			return errors.New("a CurseForge manifest.json only lists the CurseForge file ids, installing it needs the CurseForge API, set the CURSEFORGE_API_KEY environment variable")
+		}
+		files, err := getCFFiles(manifest.Files)
+		if err != nil {
+			return fmt.Errorf("unable to resolve curseforge files: %s", err.Error())
+		}
+		l.setPack(manifest.Name, localPackId(manifest.Name), localContentId(data), manifest.Version)
+		l.version.Targets = targets
+		l.version.Memory = defaultMemory
+		l.version.Files = files
+		l.version.Overrides = cfOverrides(overridesSource, manifest, false)
+	case probe.FormatVersion != 0 && probe.Dependencies != nil:
+		var index structs.MRIndex
+		if err := json.Unmarshal(data, &index); err != nil {
+			return err
+		}
+		targets, err := parseMRTargets(index.Dependencies)
+		if err != nil {
+			return err
+		}
+		l.setPack(index.Name, localPackId(index.Name), localContentId(data), index.VersionID)
+		l.version.Targets = targets
+		l.version.Memory = defaultMemory
+		l.version.Files = parseMRFiles(index.Files)
+		l.version.Overrides = mrOverrides(overridesSource, false)
+	case len(probe.Targets) > 0:
+		var ftbVersion structs.FTBVersion
+		if err := json.Unmarshal(data, &ftbVersion); err != nil {
+			return err
+		}
+		l.setPack(fmt.Sprintf("FTB modpack %d", ftbVersion.Parent), ftbVersion.Parent, ftbVersion.ID, ftbVersion.Name)
+		l.version.Targets = parseFTBTargets(ftbVersion.Targets)
+		l.version.Memory = structs.Memory{
+			Minimum:     ftbVersion.Specs.Minimum,
+			Recommended: ftbVersion.Specs.Recommended,
+		}
+		l.version.Files = parseFTBFiles(ftbVersion.Files)
+	default:
+		return errors.New("unrecognised modpack json, expected a curseforge, modrinth or ftb version json")
+	}
+
+	return nil
+}
+
+func (l *Local) setPack(name string, id int, versionId int, versionName string) {
+	l.modpack = structs.Modpack{
+		Id:   id,
+		Name: name,
+		Versions: []structs.ModpackV{
+			{Id: versionId, Type: "release"},
+		},
+	}
+	l.version.Id = versionId
+	l.version.Name = versionName
+}
+
+func localPackId(name string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.ToLower(name)))
+	return int(h.Sum32())
+}
+
+// localContentId is the version id of a pack json, it's kept positive so it fits in an int on 32-bit platforms.
+// The ids are hashes, they only tell if the pack changed and not which of two versions is newer.
+func localContentId(data []byte) int {
+	h := fnv.New32a()
+	_, _ = h.Write(data)
+	return int(h.Sum32() & math.MaxInt32)
+}
@@ -0,0 +1,159 @@
+package repos
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"ftb-server-downloader/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestMrpack(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create(mrIndexName)
+	_ = json.NewEncoder(w).Encode(structs.MRIndex{
+		FormatVersion: 1,
+		Game:          "minecraft",
+		VersionID:     "1.2.3",
+		Name:          "Local Pack",
+		Files: []structs.MRIndexFile{
+			{Path: "mods/a.jar", Hashes: structs.MRHashes{Sha1: "aa"}, Downloads: []string{"https://cdn/a.jar"}},
+		},
+		Dependencies: map[string]string{"minecraft": "1.20.1", "fabric-loader": "0.15.0"},
+	})
+	w, _ = zw.Create("overrides/config/a.toml")
+	_, _ = w.Write([]byte("a = 1\n"))
+	w, _ = zw.Create("server-overrides/config/a.toml")
+	_, _ = w.Write([]byte("a = 2\n"))
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalMrpack(t *testing.T) {
+	dir := t.TempDir()
+	packPath := filepath.Join(dir, "pack.mrpack")
+	writeTestMrpack(t, packPath)
+
+	local := GetLocal(packPath, 0)
+	modpack, err := local.GetModpack()
+	if err != nil {
+		t.Fatalf("GetModpack: %s", err)
+	}
+	if modpack.Name != "Local Pack" || len(modpack.Versions) != 1 {
+		t.Fatalf("got %+v, want one version of Local Pack", modpack)
+	}
+
+	local.SetVersionId(modpack.Versions[0].Id)
+	version, err := local.GetVersion()
+	if err != nil {
+		t.Fatalf("GetVersion: %s", err)
+	}
+	if version.Name != "1.2.3" || version.Targets.ModLoader.Name != "fabric" || len(version.Files) != 1 {
+		t.Errorf("got %+v, want fabric version 1.2.3 with one file", version)
+	}
+
+	overrides, err := util.OverrideFiles(version.Overrides)
+	if err != nil {
+		t.Fatalf("OverrideFiles: %s", err)
+	}
+	if len(overrides) != 1 || overrides[0].Path != "config" || overrides[0].Name != "a.toml" || overrides[0].Hash != fmt.Sprintf("%x", sha1.Sum([]byte("a = 2\n"))) {
+		t.Errorf("got overrides %+v, want config/a.toml from server-overrides", overrides)
+	}
+
+	installDir := filepath.Join(dir, "server")
+	if err = util.CopyOverrides(version.Overrides, overrides, installDir); err != nil {
+		t.Fatalf("CopyOverrides: %s", err)
+	}
+	config, err := os.ReadFile(filepath.Join(installDir, "config", "a.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(config) != "a = 2\n" {
+		t.Errorf("got config %q, want server-overrides to win", config)
+	}
+	if _, err = os.Stat(packPath); err != nil {
+		t.Errorf("local source should not be removed after copying overrides: %s", err)
+	}
+}
+
+func TestLocalUnknownJson(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pack.json")
+	if err := os.WriteFile(path, []byte(`{"hello": "world"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetLocal(path, 0).GetModpack(); err == nil {
+		t.Error("expected an error for an unrecognised json")
+	}
+}
+
+func TestLocalVersionFromContent(t *testing.T) {
+	dir := t.TempDir()
+	writeIndex := func(name, version string) string {
+		path := filepath.Join(dir, name)
+		data, _ := json.Marshal(structs.MRIndex{
+			FormatVersion: 1,
+			Game:          "minecraft",
+			VersionID:     version,
+			Name:          "Local Pack",
+			Dependencies:  map[string]string{"minecraft": "1.20.1", "fabric-loader": "0.15.0"},
+		})
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	versionId := func(path string) int {
+		version, err := GetLocal(path, 0).GetVersion()
+		if err != nil {
+			t.Fatalf("GetVersion: %s", err)
+		}
+		return version.Id
+	}
+
+	first := versionId(writeIndex("a.json", "1.0.0"))
+	// A copy of the same pack made later is the same version
+	copied := writeIndex("b.json", "1.0.0")
+	if err := os.Chtimes(copied, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := versionId(copied); got != first {
+		t.Errorf("copy of the pack has version %d, want %d", got, first)
+	}
+	if got := versionId(writeIndex("c.json", "1.0.1")); got == first || got <= 0 {
+		t.Errorf("changed pack has version %d, want a positive id other than %d", got, first)
+	}
+}
+
+func TestLocalCurseForgeNeedsApiKey(t *testing.T) {
+	oldKey := util.CfApiKey
+	util.CfApiKey = ""
+	defer func() { util.CfApiKey = oldKey }()
+	path := filepath.Join(t.TempDir(), cfManifestName)
+	data, _ := json.Marshal(structs.CFManifest{
+		Minecraft:    structs.CFManifestMinecraft{Version: "1.20.1", ModLoaders: []structs.CFManifestModLoader{{ID: "forge-47.2.0", Primary: true}}},
+		ManifestType: "minecraftModpack",
+		Name:         "Local Pack",
+		Files:        []structs.CFManifestFile{{ProjectID: 1, FileID: 2, Required: true}},
+	})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := GetLocal(path, 0).GetModpack()
+	if err == nil || !strings.Contains(err.Error(), "CURSEFORGE_API_KEY") {
+		t.Errorf("got error %v, want one asking for CURSEFORGE_API_KEY", err)
+	}
+}
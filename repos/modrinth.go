@@ -0,0 +1,305 @@
+package repos
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"ftb-server-downloader/util"
+	"hash/fnv"
+	"io/fs"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+var (
+	// mrAPIUrl is a var so tests can point the provider at a local stand-in server
+	mrAPIUrl = "https://api.modrinth.com/v2"
+)
+
+const (
+	mrIndexName = "modrinth.index.json"
+)
+
+// mrLoaders maps the modrinth.index.json dependency names to our modloader names
+var mrLoaders = [][2]string{
+	{"forge", "forge"},
+	{"neoforge", "neoforge"},
+	{"fabric-loader", "fabric"},
+	{"quilt-loader", "quilt"},
+}
+
+// Modrinth uses string ids for projects and versions. Versions are numbered internally by the order they were
+// published in, starting at 1, so they can be ordered and compared like the other providers' version ids, and
+// the project id is hashed for the modpack id
+type Modrinth struct {
+	ProjectId   string
+	VersionId   int
+	VersionName string
+	versions    []structs.MRVersion
+}
+
+func GetModrinth(projectId string, versionName string) *Modrinth {
+	return &Modrinth{
+		ProjectId:   projectId,
+		VersionName: versionName,
+	}
+}
+
+func (m *Modrinth) GetModpack() (structs.Modpack, error) {
+	projectUrl := fmt.Sprintf("%s/project/%s", mrAPIUrl, url.PathEscape(m.ProjectId))
+	pterm.Debug.Printfln("Getting modpack from modrinth using %s", projectUrl)
+
+	var project structs.MRProject
+	if err := mrGet(projectUrl, &project); err != nil {
+		return structs.Modpack{}, err
+	}
+	if project.ProjectType != "" && project.ProjectType != "modpack" {
+		return structs.Modpack{}, fmt.Errorf("modrinth project %s is a %s, not a modpack", m.ProjectId, project.ProjectType)
+	}
+
+	if err := m.getVersions(); err != nil {
+		return structs.Modpack{}, err
+	}
+
+	var versionList []structs.ModpackV
+	for i, v := range m.versions {
+		if m.VersionName != "" && (v.ID == m.VersionName || v.VersionNumber == m.VersionName) {
+			m.VersionId = i + 1
+		}
+		versionList = append(versionList, structs.ModpackV{
+			Id:   i + 1,
+			Type: strings.ToLower(v.VersionType),
+		})
+	}
+	if m.VersionName != "" && m.VersionId == 0 {
+		return structs.Modpack{}, fmt.Errorf("version %s not found for modrinth project %s", m.VersionName, m.ProjectId)
+	}
+
+	sort.Slice(versionList, func(i, j int) bool {
+		return versionList[i].Id > versionList[j].Id
+	})
+
+	return structs.Modpack{
+		Name:     project.Title,
+		Id:       mrProjectId(project.ID),
+		Versions: versionList,
+	}, nil
+}
+
+func (m *Modrinth) GetVersion() (structs.ModpackVersion, error) {
+	if m.versions == nil {
+		if err := m.getVersions(); err != nil {
+			return structs.ModpackVersion{}, err
+		}
+	}
+
+	if m.VersionId < 1 || m.VersionId > len(m.versions) {
+		return structs.ModpackVersion{}, fmt.Errorf("version %d not found for modrinth project %s", m.VersionId, m.ProjectId)
+	}
+	version := m.versions[m.VersionId-1]
+	pterm.Debug.Printfln("Getting modpack version %s (%s) from modrinth", version.VersionNumber, version.ID)
+
+	index, archive, err := m.getIndex(version)
+	if err != nil {
+		return structs.ModpackVersion{}, err
+	}
+
+	targets, err := parseMRTargets(index.Dependencies)
+	if err != nil {
+		_ = os.Remove(archive)
+		return structs.ModpackVersion{}, err
+	}
+
+	return structs.ModpackVersion{
+		Id:        m.VersionId,
+		Name:      version.VersionNumber,
+		Targets:   targets,
+		Memory:    defaultMemory,
+		Files:     parseMRFiles(index.Files),
+		Overrides: mrOverrides(archive, true),
+	}, nil
+}
+
+func (m *Modrinth) SetVersionId(versionId int) {
+	m.VersionId = versionId
+}
+
+func (m *Modrinth) SuccessfulInstall() {
+	return
+}
+
+func (m *Modrinth) FailedInstall() {
+	return
+}
+
+func (m *Modrinth) getVersions() error {
+	versionsUrl := fmt.Sprintf("%s/project/%s/version", mrAPIUrl, url.PathEscape(m.ProjectId))
+	pterm.Debug.Printfln("Getting modpack versions from modrinth using %s", versionsUrl)
+
+	var versions []structs.MRVersion
+	if err := mrGet(versionsUrl, &versions); err != nil {
+		return err
+	}
+	// Oldest first, the position is the version id. Versions published in the same second are ordered by
+	// their id so the order is the same every time.
+	sort.Slice(versions, func(i, j int) bool {
+		if !versions[i].DatePublished.Equal(versions[j].DatePublished) {
+			return versions[i].DatePublished.Before(versions[j].DatePublished)
+		}
+		return versions[i].ID < versions[j].ID
+	})
+	m.versions = versions
+	return nil
+}
+
+// getIndex downloads the .mrpack for a version and reads the modrinth.index.json from it, the
+// archive is kept so the overrides can be copied once the pack files have been downloaded
+func (m *Modrinth) getIndex(version structs.MRVersion) (structs.MRIndex, string, error) {
+	var packFile *structs.MRVersionFile
+	for i, f := range version.Files {
+		if f.Primary || (packFile == nil && strings.HasSuffix(f.Filename, ".mrpack")) {
+			packFile = &version.Files[i]
+		}
+	}
+	if packFile == nil {
+		return structs.MRIndex{}, "", fmt.Errorf("version %s has no .mrpack file", version.VersionNumber)
+	}
+
+	tmpFile, err := os.CreateTemp("", "ftb-mr-pack-*.mrpack")
+	if err != nil {
+		return structs.MRIndex{}, "", err
+	}
+	_ = tmpFile.Close()
+
+	index, err := func() (structs.MRIndex, error) {
+		dl, err := util.NewDownload(tmpFile.Name(), packFile.URL)
+		if err != nil {
+			return structs.MRIndex{}, err
+		}
+		if packFile.Hashes.Sha1 != "" {
+			hexHash, _ := hex.DecodeString(packFile.Hashes.Sha1)
+			dl.SetChecksum(sha1.New(), hexHash, true)
+		}
+		if err = dl.Do(); err != nil {
+			return structs.MRIndex{}, fmt.Errorf("unable to download mrpack: %s", err.Error())
+		}
+
+		packFS, closeFS, err := util.OpenPackFS(tmpFile.Name())
+		if err != nil {
+			return structs.MRIndex{}, err
+		}
+		defer closeFS()
+		return readMRIndex(packFS)
+	}()
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return structs.MRIndex{}, "", err
+	}
+	return index, tmpFile.Name(), nil
+}
+
+func readMRIndex(packFS fs.FS) (structs.MRIndex, error) {
+	indexFile, err := packFS.Open(mrIndexName)
+	if err != nil {
+		return structs.MRIndex{}, fmt.Errorf("mrpack does not contain a %s: %s", mrIndexName, err.Error())
+	}
+	defer indexFile.Close()
+
+	var index structs.MRIndex
+	if err = json.NewDecoder(indexFile).Decode(&index); err != nil {
+		return structs.MRIndex{}, err
+	}
+	if index.Game != "" && index.Game != "minecraft" {
+		return structs.MRIndex{}, fmt.Errorf("unsupported mrpack game '%s'", index.Game)
+	}
+	return index, nil
+}
+
+// mrOverrides returns the overrides of an mrpack, server-overrides are copied last so they win
+func mrOverrides(source string, temporary bool) structs.Overrides {
+	return structs.Overrides{
+		Source:    source,
+		Dirs:      []string{"overrides", "server-overrides"},
+		Temporary: temporary,
+	}
+}
+
+func parseMRTargets(dependencies map[string]string) (structs.ModpackTargets, error) {
+	var modpackTargets structs.ModpackTargets
+	modpackTargets.McVersion = dependencies["minecraft"]
+	if modpackTargets.McVersion == "" {
+		return structs.ModpackTargets{}, errors.New("mrpack does not depend on a minecraft version")
+	}
+
+	for _, loader := range mrLoaders {
+		if version, ok := dependencies[loader[0]]; ok {
+			modpackTargets.ModLoader.Name = loader[1]
+			modpackTargets.ModLoader.Version = version
+			break
+		}
+	}
+	if modpackTargets.ModLoader.Name == "" {
+		return structs.ModpackTargets{}, errors.New("no modloader found in mrpack dependencies")
+	}
+
+	javaVersion, err := javaVersionForMinecraft(modpackTargets.McVersion)
+	if err != nil {
+		return structs.ModpackTargets{}, err
+	}
+	modpackTargets.JavaVersion = javaVersion
+
+	return modpackTargets, nil
+}
+
+func parseMRFiles(files []structs.MRIndexFile) []structs.File {
+	var parsedFiles []structs.File
+	for _, f := range files {
+		if f.Env != nil && f.Env.Server == "unsupported" {
+			continue
+		}
+		if len(f.Downloads) == 0 {
+			continue
+		}
+
+		dir := path.Dir(f.Path)
+		if dir == "." {
+			dir = ""
+		}
+		parsedFiles = append(parsedFiles, structs.File{
+			Name:     path.Base(f.Path),
+			Path:     dir,
+			Url:      f.Downloads[0],
+			Hash:     f.Hashes.Sha1,
+			HashType: "sha1",
+			Size:     f.FileSize,
+			Mirrors:  f.Downloads[1:],
+		})
+	}
+	return parsedFiles
+}
+
+// mrProjectId hashes a modrinth project id into a modpack id, the base62 ids don't fit in an int on 32-bit
+// platforms
+func mrProjectId(id string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return int(h.Sum32() & math.MaxInt32)
+}
+
+func mrGet(url string, out any) error {
+	resp, err := util.DoGet(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,158 @@
+package repos
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMRFiles(t *testing.T) {
+	files := parseMRFiles([]structs.MRIndexFile{
+		{Path: "mods/server.jar", Hashes: structs.MRHashes{Sha1: "aa"}, Downloads: []string{"https://a/server.jar", "https://b/server.jar"}},
+		{Path: "mods/client.jar", Env: &structs.MREnv{Client: "required", Server: "unsupported"}, Downloads: []string{"https://a/client.jar"}},
+		{Path: "mods/optional.jar", Env: &structs.MREnv{Client: "required", Server: "optional"}, Downloads: []string{"https://a/optional.jar"}},
+		{Path: "options.txt", Downloads: []string{"https://a/options.txt"}},
+	})
+
+	var tests = []struct {
+		name, path, url string
+		mirrors         int
+	}{
+		{"server.jar", "mods", "https://a/server.jar", 1},
+		{"optional.jar", "mods", "https://a/optional.jar", 0},
+		{"options.txt", "", "https://a/options.txt", 0},
+	}
+	if len(files) != len(tests) {
+		t.Fatalf("got %d files, want %d: %+v", len(files), len(tests), files)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := files[i]
+			if f.Name != tt.name || f.Path != tt.path || f.Url != tt.url || len(f.Mirrors) != tt.mirrors {
+				t.Errorf("got %+v, want %+v", f, tt)
+			}
+		})
+	}
+}
+
+func TestParseMRTargets(t *testing.T) {
+	var tests = []struct {
+		name    string
+		deps    map[string]string
+		loader  string
+		java    string
+		wantErr bool
+	}{
+		{"fabric", map[string]string{"minecraft": "1.20.1", "fabric-loader": "0.15.0"}, "fabric", "17", false},
+		{"neoforge", map[string]string{"minecraft": "1.21.1", "neoforge": "21.1.77"}, "neoforge", "21", false},
+		{"quilt", map[string]string{"minecraft": "1.19.2", "quilt-loader": "0.20.0"}, "quilt", "17", false},
+		{"forge 1.12.2", map[string]string{"minecraft": "1.12.2", "forge": "14.23.5.2860"}, "forge", "8", false},
+		{"no loader", map[string]string{"minecraft": "1.20.1"}, "", "", true},
+		{"no minecraft", map[string]string{"forge": "47.2.0"}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := parseMRTargets(tt.deps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if targets.ModLoader.Name != tt.loader || targets.JavaVersion != tt.java {
+				t.Errorf("got %+v, want %s java %s", targets, tt.loader, tt.java)
+			}
+		})
+	}
+}
+
+func newModrinthServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var mrpack bytes.Buffer
+	zw := zip.NewWriter(&mrpack)
+	w, _ := zw.Create(mrIndexName)
+	_ = json.NewEncoder(w).Encode(structs.MRIndex{
+		FormatVersion: 1,
+		Game:          "minecraft",
+		VersionID:     "1.1.0",
+		Name:          "Test Pack",
+		Files: []structs.MRIndexFile{
+			{Path: "mods/a.jar", Hashes: structs.MRHashes{Sha1: "aa"}, Downloads: []string{"https://cdn.modrinth.com/a.jar"}},
+		},
+		Dependencies: map[string]string{"minecraft": "1.20.1", "fabric-loader": "0.15.0"},
+	})
+	_ = zw.Close()
+	packSha1 := fmt.Sprintf("%x", sha1.Sum(mrpack.Bytes()))
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+
+	published := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mux.HandleFunc("GET /project/test-pack", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(structs.MRProject{ID: "AABBCCDD", Slug: "test-pack", Title: "Test Pack", ProjectType: "modpack"})
+	})
+	mux.HandleFunc("GET /project/test-pack/version", func(w http.ResponseWriter, r *http.Request) {
+		// Newest first like the API, 1.1.0 and 1.1.0-beta were published in the same second
+		_ = json.NewEncoder(w).Encode([]structs.MRVersion{
+			{ID: "ver3", VersionNumber: "1.1.0", VersionType: "release", DatePublished: published.Add(time.Hour), Files: []structs.MRVersionFile{
+				{URL: srv.URL + "/pack.mrpack", Filename: "pack.mrpack", Primary: true, Hashes: structs.MRHashes{Sha1: packSha1}},
+			}},
+			{ID: "ver2", VersionNumber: "1.1.0-beta", VersionType: "beta", DatePublished: published.Add(time.Hour)},
+			{ID: "ver1", VersionNumber: "1.0.0", VersionType: "release", DatePublished: published},
+		})
+	})
+	mux.HandleFunc("GET /pack.mrpack", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(mrpack.Bytes())
+	})
+
+	return srv
+}
+
+func TestModrinth(t *testing.T) {
+	srv := newModrinthServer(t)
+	defer srv.Close()
+
+	oldUrl := mrAPIUrl
+	mrAPIUrl = srv.URL
+	defer func() { mrAPIUrl = oldUrl }()
+
+	mr := GetModrinth("test-pack", "1.1.0")
+	modpack, err := mr.GetModpack()
+	if err != nil {
+		t.Fatalf("GetModpack: %s", err)
+	}
+	if modpack.Name != "Test Pack" || modpack.Id != mrProjectId("AABBCCDD") || modpack.Id <= 0 {
+		t.Errorf("got modpack %s (%d), want Test Pack (%d)", modpack.Name, modpack.Id, mrProjectId("AABBCCDD"))
+	}
+	want := []structs.ModpackV{{Id: 3, Type: "release"}, {Id: 2, Type: "beta"}, {Id: 1, Type: "release"}}
+	if !reflect.DeepEqual(modpack.Versions, want) {
+		t.Errorf("got versions %+v, want %+v", modpack.Versions, want)
+	}
+	if mr.VersionId != 3 {
+		t.Fatalf("got version id %d for 1.1.0, want 3", mr.VersionId)
+	}
+
+	version, err := mr.GetVersion()
+	if err != nil {
+		t.Fatalf("GetVersion: %s", err)
+	}
+	defer os.Remove(version.Overrides.Source)
+	if version.Id != 3 || version.Name != "1.1.0" || version.Targets.ModLoader.Name != "fabric" {
+		t.Errorf("got version %d %s with %s, want 3 1.1.0 with fabric", version.Id, version.Name, version.Targets.ModLoader.Name)
+	}
+	if len(version.Files) != 1 || version.Files[0].Name != "a.jar" || version.Files[0].Path != "mods" {
+		t.Errorf("got files %+v, want mods/a.jar", version.Files)
+	}
+
+	mr.SetVersionId(4)
+	if _, err = mr.GetVersion(); err == nil {
+		t.Error("expected an error for a version that doesn't exist")
+	}
+}
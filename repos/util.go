@@ -0,0 +1,49 @@
+package repos
+
+import (
+	"errors"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"strings"
+
+	semVer "github.com/hashicorp/go-version"
+)
+
+// defaultMemory is used for providers that don't publish memory requirements for their packs
+var defaultMemory = structs.Memory{
+	Minimum:     4096,
+	Recommended: 6144,
+}
+
+// javaVersionForMinecraft returns the java major version Mojang ships with the given Minecraft version
+func javaVersionForMinecraft(mcVersion string) (string, error) {
+	mcSemVer, err := semVer.NewVersion(mcVersion)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse minecraft version %s: %s", mcVersion, err.Error())
+	}
+
+	switch {
+	case mcSemVer.LessThan(semVer.Must(semVer.NewVersion("1.17"))):
+		return "8", nil
+	case mcSemVer.LessThan(semVer.Must(semVer.NewVersion("1.18"))):
+		return "16", nil
+	case mcSemVer.LessThan(semVer.Must(semVer.NewVersion("1.20.5"))):
+		return "17", nil
+	case mcSemVer.LessThan(semVer.Must(semVer.NewVersion("26.0"))):
+		return "21", nil
+	default:
+		return "25", nil
+	}
+}
+
+// parseLoaderId splits a loader id such as "forge-47.2.0" into its name and version
+func parseLoaderId(id string) (structs.ModLoaderTarget, error) {
+	name, version, found := strings.Cut(id, "-")
+	if !found || name == "" || version == "" {
+		return structs.ModLoaderTarget{}, errors.New(fmt.Sprintf("invalid modloader id '%s'", id))
+	}
+	return structs.ModLoaderTarget{
+		Name:    strings.ToLower(name),
+		Version: version,
+	}, nil
+}
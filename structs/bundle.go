@@ -0,0 +1,38 @@
+package structs
+
+import "time"
+
+// BundleManifest describes an offline install bundle made by the bundle create command, the pack is resolved
+// again at install time from the recorded responses so the flags that picked it are kept rather than the result
+type BundleManifest struct {
+	Format           int              `json:"format"`
+	Created          time.Time        `json:"created"`
+	InstallerVersion string           `json:"installer_version"`
+	Os               string           `json:"os"`
+	Arch             string           `json:"arch"`
+	Provider         string           `json:"provider"`
+	PackId           int              `json:"pack,omitempty"`
+	VersionId        int              `json:"version,omitempty"`
+	Project          string           `json:"project,omitempty"`
+	ProjectVersion   string           `json:"project_version,omitempty"`
+	Latest           bool             `json:"latest,omitempty"`
+	Source           string           `json:"source,omitempty"` // Copy of the local provider's source, relative to the bundle
+	Name             string           `json:"name"`
+	VersionName      string           `json:"version_name"`
+	SkipModloader    bool             `json:"skip_modloader,omitempty"`  // The modloader isn't installed from the bundle
+	Modloader        string           `json:"modloader,omitempty"`       // Output of the modloader installer, run when the bundle was made, relative to the bundle
+	FabricLauncher   string           `json:"fabric_launcher,omitempty"` // sha256 of Fabric's prebuilt launcher if it's bundled instead of its installer
+	Java             *File            `json:"java,omitempty"`
+	Responses        []BundleResponse `json:"responses"`
+}
+
+// BundleResponse is an HTTP response recorded in a bundle
+type BundleResponse struct {
+	Method      string              `json:"method"`
+	Url         string              `json:"url"`
+	RequestBody string              `json:"request_body,omitempty"` // sha256 of the body of a POST, it's part of what's asked for
+	Status      int                 `json:"status"`
+	Header      map[string][]string `json:"header,omitempty"`
+	Body        string              `json:"body,omitempty"` // sha256 of the body, also its file name in the bundle
+	Size        int64               `json:"size"`
+}
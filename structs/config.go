@@ -0,0 +1,44 @@
+package structs
+
+// InstallerConfig is the config file read with -config or from an ftb-installer.json next to the installer.
+// The keys match the command line flags, fields left out of the file are nil and leave the flag default alone.
+type InstallerConfig struct {
+	Provider             *string           `json:"provider,omitempty"`
+	Pack                 *int              `json:"pack,omitempty"`
+	Version              *int              `json:"version,omitempty"`
+	Project              *string           `json:"project,omitempty"`
+	ProjectVersion       *string           `json:"project-version,omitempty"`
+	Source               *string           `json:"source,omitempty"`
+	Channel              *string           `json:"channel,omitempty"` // "release" or "latest", the same as -latest
+	Dir                  *string           `json:"dir,omitempty"`
+	Threads              *int              `json:"threads,omitempty"`
+	Timeout              *int              `json:"timeout,omitempty"`
+	ConnectTimeout       *int              `json:"connect-timeout,omitempty"`
+	Proxy                *string           `json:"proxy,omitempty"`
+	CACert               *string           `json:"ca-cert,omitempty"`
+	Mirrors              map[string]string `json:"mirrors,omitempty"` // URL prefix to mirror URL, see -mirror
+	ApiKey               *string           `json:"apikey,omitempty"`
+	Auto                 *bool             `json:"auto,omitempty"`
+	Force                *bool             `json:"force,omitempty"`
+	Validate             *bool             `json:"validate,omitempty"`
+	SkipModloader        *bool             `json:"skip-modloader,omitempty"`
+	JavaProvider         *string           `json:"java-provider,omitempty"`
+	NoJava               *bool             `json:"no-java,omitempty"`
+	AcceptEula           *bool             `json:"accept-eula,omitempty"`
+	FabricLauncher       *bool             `json:"fabric-launcher,omitempty"`
+	FabricLauncherSha256 *string           `json:"fabric-launcher-sha256,omitempty"`
+	CacheDir             *string           `json:"cache-dir,omitempty"`
+	CacheMaxSize         *int64            `json:"cache-max-size,omitempty"`
+	RuntimeDir           *string           `json:"runtime-dir,omitempty"`
+	UpdateChannel        *string           `json:"update-channel,omitempty"` // "stable", "beta" or "none", the same as -update-channel
+	InstallerVersion     *string           `json:"installer-version,omitempty"`
+	LocalEdits           *string           `json:"local-edits,omitempty"` // "overwrite", "keep" or "merge", the same as -local-edits
+	Memory               *ConfigMemory     `json:"memory,omitempty"`
+	Exclude              []string          `json:"exclude,omitempty"` // Glob patterns of pack files to skip, e.g. "mods/somemod-*.jar" or "config/somemod"
+}
+
+// ConfigMemory overrides the memory the modpack asks for in the start script, in MB
+type ConfigMemory struct {
+	Minimum     int `json:"minimum,omitempty"`
+	Recommended int `json:"recommended,omitempty"`
+}
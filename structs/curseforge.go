@@ -0,0 +1,80 @@
+package structs
+
+type CFModResponse struct {
+	Data CFMod `json:"data"`
+}
+
+type CFModsResponse struct {
+	Data []CFMod `json:"data"`
+}
+
+type CFMod struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Slug    string `json:"slug"`
+	ClassID int    `json:"classId"`
+}
+
+type CFFileResponse struct {
+	Data CFFile `json:"data"`
+}
+
+type CFFilesResponse struct {
+	Data       []CFFile     `json:"data"`
+	Pagination CFPagination `json:"pagination"`
+}
+
+type CFPagination struct {
+	Index       int `json:"index"`
+	PageSize    int `json:"pageSize"`
+	ResultCount int `json:"resultCount"`
+	TotalCount  int `json:"totalCount"`
+}
+
+type CFFile struct {
+	ID           int      `json:"id"`
+	ModID        int      `json:"modId"`
+	DisplayName  string   `json:"displayName"`
+	FileName     string   `json:"fileName"`
+	ReleaseType  int      `json:"releaseType"`
+	Hashes       []CFHash `json:"hashes"`
+	FileLength   int64    `json:"fileLength"`
+	DownloadURL  string   `json:"downloadUrl"`
+	GameVersions []string `json:"gameVersions"`
+	IsServerPack bool     `json:"isServerPack"`
+}
+
+type CFHash struct {
+	Value string `json:"value"`
+	Algo  int    `json:"algo"`
+}
+
+///////////////////////////////////////////
+
+// CFManifest is the manifest.json found in the root of a CurseForge modpack archive
+type CFManifest struct {
+	Minecraft       CFManifestMinecraft `json:"minecraft"`
+	ManifestType    string              `json:"manifestType"`
+	ManifestVersion int                 `json:"manifestVersion"`
+	Name            string              `json:"name"`
+	Version         string              `json:"version"`
+	Author          string              `json:"author"`
+	Files           []CFManifestFile    `json:"files"`
+	Overrides       string              `json:"overrides"`
+}
+
+type CFManifestMinecraft struct {
+	Version    string                `json:"version"`
+	ModLoaders []CFManifestModLoader `json:"modLoaders"`
+}
+
+type CFManifestModLoader struct {
+	ID      string `json:"id"`
+	Primary bool   `json:"primary"`
+}
+
+type CFManifestFile struct {
+	ProjectID int  `json:"projectID"`
+	FileID    int  `json:"fileID"`
+	Required  bool `json:"required"`
+}
@@ -0,0 +1,8 @@
+package structs
+
+type LibericaRelease struct {
+	DownloadUrl string `json:"downloadUrl"`
+	Filename    string `json:"filename"`
+	Sha1        string `json:"sha1"`
+	Size        int64  `json:"size"`
+}
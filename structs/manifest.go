@@ -7,4 +7,5 @@ type Manifest struct {
 	VersionId      int            `json:"versionId"`
 	ModpackTargets ModpackTargets `json:"modPackTargets"`
 	Files          []File         `json:"files,omitempty"`
+	Runtime        string         `json:"runtime,omitempty"` // Shared runtime the start scripts use, see -runtime-dir
 }
@@ -12,11 +12,19 @@ type ModpackV struct {
 }
 
 type ModpackVersion struct {
-	Id      int
-	Name    string
-	Files   []File
-	Targets ModpackTargets
-	Memory  Memory
+	Id        int
+	Name      string
+	Files     []File
+	Targets   ModpackTargets
+	Memory    Memory
+	Overrides Overrides
+}
+
+// Overrides are files bundled inside a modpack archive that get copied over the install directory
+type Overrides struct {
+	Source    string   // Path to the zip archive or directory containing the overrides
+	Dirs      []string // Folders inside Source to copy, later folders take priority
+	Temporary bool     // Source was downloaded by the provider and should be removed once it's no longer needed
 }
 
 type File struct {
@@ -26,7 +34,9 @@ type File struct {
 	Mirrors            []string `json:"mirrors"`
 	Hash               string   `json:"hash"`
 	HashType           string   `json:"hash_type"`
+	Size               int64    `json:"size,omitempty"`
 	CheckContentLength bool     `json:"check_content_length"`
+	Override           bool     `json:"override,omitempty"` // Copied from the pack's Overrides instead of downloaded
 }
 
 type ModLoaderTarget struct {
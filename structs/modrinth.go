@@ -0,0 +1,59 @@
+package structs
+
+import "time"
+
+type MRProject struct {
+	ID          string `json:"id"`
+	Slug        string `json:"slug"`
+	Title       string `json:"title"`
+	ProjectType string `json:"project_type"`
+}
+
+type MRVersion struct {
+	ID            string          `json:"id"`
+	ProjectID     string          `json:"project_id"`
+	Name          string          `json:"name"`
+	VersionNumber string          `json:"version_number"`
+	VersionType   string          `json:"version_type"`
+	DatePublished time.Time       `json:"date_published"`
+	Files         []MRVersionFile `json:"files"`
+}
+
+type MRVersionFile struct {
+	Hashes   MRHashes `json:"hashes"`
+	URL      string   `json:"url"`
+	Filename string   `json:"filename"`
+	Primary  bool     `json:"primary"`
+	Size     int64    `json:"size"`
+}
+
+type MRHashes struct {
+	Sha1   string `json:"sha1"`
+	Sha512 string `json:"sha512"`
+}
+
+///////////////////////////////////////////
+
+// MRIndex is the modrinth.index.json found in the root of a .mrpack archive
+type MRIndex struct {
+	FormatVersion int               `json:"formatVersion"`
+	Game          string            `json:"game"`
+	VersionID     string            `json:"versionId"`
+	Name          string            `json:"name"`
+	Summary       string            `json:"summary"`
+	Files         []MRIndexFile     `json:"files"`
+	Dependencies  map[string]string `json:"dependencies"`
+}
+
+type MRIndexFile struct {
+	Path      string   `json:"path"`
+	Hashes    MRHashes `json:"hashes"`
+	Env       *MREnv   `json:"env,omitempty"`
+	Downloads []string `json:"downloads"`
+	FileSize  int64    `json:"fileSize"`
+}
+
+type MREnv struct {
+	Client string `json:"client"`
+	Server string `json:"server"`
+}
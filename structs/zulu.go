@@ -0,0 +1,10 @@
+package structs
+
+type ZuluPackage struct {
+	PackageUuid string `json:"package_uuid"`
+	Name        string `json:"name"`
+	DownloadUrl string `json:"download_url"`
+	JavaVersion []int  `json:"java_version"`
+	Sha256Hash  string `json:"sha256_hash"` // Only in the package details
+	Size        int64  `json:"size"`        // Only in the package details
+}
@@ -1,19 +1,17 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"ftb-server-downloader/util"
 	"io"
-	"net/http"
 	"os"
 	"runtime"
+	"slices"
 	"strings"
 
 	semver "github.com/hashicorp/go-version"
-	"github.com/minio/selfupdate"
 	"github.com/pterm/pterm"
 )
 
@@ -22,6 +20,15 @@ const (
 	repo = "FTB-Server-Installer"
 )
 
+var (
+	// releaseApiUrl and releaseDownloadUrl are where releases are looked up and their binaries and signatures
+	// are downloaded from
+	releaseApiUrl      = fmt.Sprintf("https://api.github.com/repos/%s/%s/releases", org, repo)
+	releaseDownloadUrl = fmt.Sprintf("https://github.com/%s/%s/releases/download", org, repo)
+
+	updateChannels = []string{"stable", "beta", "none"}
+)
+
 type GHRelease struct {
 	TagName    string `json:"tag_name"`
 	Name       string `json:"name"`
@@ -37,6 +44,22 @@ type VersionInfo struct {
 	isPreReleaseOrDraft bool
 }
 
+// setupUpdates applies FTB_INSTALLER_UPDATE_CHANNEL and checks the update flags
+func setupUpdates() error {
+	if env := os.Getenv("FTB_INSTALLER_UPDATE_CHANNEL"); env != "" && !isFlagSet("update-channel") {
+		updateChannel = env
+	}
+	if !slices.Contains(updateChannels, updateChannel) {
+		return fmt.Errorf("unknown update channel '%s', valid channels are %s", updateChannel, strings.Join(updateChannels, ", "))
+	}
+	if installerVersion != "" && !strings.HasPrefix(installerVersion, "v") {
+		installerVersion = "v" + installerVersion
+	}
+	return nil
+}
+
+// checkForUpdate finds the release to update to, the newest on the -update-channel or the -installer-version.
+// A pinned version is an update whenever it isn't the version running, so it can also downgrade.
 func checkForUpdate() (VersionInfo, error) {
 	var versionInfo = VersionInfo{
 		UpdateAvailable:     false,
@@ -45,34 +68,32 @@ func checkForUpdate() (VersionInfo, error) {
 		Name:                "",
 		isPreReleaseOrDraft: false,
 	}
-	releaseApi := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", org, repo)
-	resp, err := http.Get(releaseApi)
-	if err != nil {
-		return versionInfo, fmt.Errorf("error checking for update: %s", err.Error())
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return versionInfo, fmt.Errorf("bad status: %s", resp.Status)
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return versionInfo, fmt.Errorf("error reading response body: %s", err.Error())
-	}
 
 	var release GHRelease
-	err = json.Unmarshal(data, &release)
+	var err error
+	switch {
+	case installerVersion != "":
+		err = getGitHub(fmt.Sprintf("%s/tags/%s", releaseApiUrl, installerVersion), &release)
+	case updateChannel == "beta":
+		release, err = getNewestRelease()
+	default:
+		err = getGitHub(releaseApiUrl+"/latest", &release)
+	}
 	if err != nil {
-		return versionInfo, fmt.Errorf("error unmarshalling response: %s", err.Error())
+		return versionInfo, fmt.Errorf("error checking for update: %s", err.Error())
 	}
-
-	if release.Prerelease || release.Draft {
-		versionInfo.isPreReleaseOrDraft = true
-		return versionInfo, nil
+	if release.Draft {
+		return versionInfo, fmt.Errorf("release %s isn't published", release.TagName)
 	}
 
 	versionInfo.LatestVersion = release.TagName
 	versionInfo.Name = release.Name
+	versionInfo.isPreReleaseOrDraft = release.Prerelease
+
+	if installerVersion != "" {
+		versionInfo.UpdateAvailable = release.TagName != util.ReleaseVersion
+		return versionInfo, nil
+	}
 
 	currentVersion, err := semver.NewVersion(strings.ReplaceAll(util.ReleaseVersion, "v", ""))
 	if err != nil {
@@ -90,54 +111,126 @@ func checkForUpdate() (VersionInfo, error) {
 	return versionInfo, nil
 }
 
-func doUpdate(versionInfo VersionInfo) error {
-	filename := fmt.Sprintf("ftb-server-%s-%s", strings.ToLower(runtime.GOOS), strings.ToLower(runtime.GOARCH))
-	if runtime.GOOS == "windows" {
-		filename += ".exe"
-	}
+// getNewestRelease is the newest release including prereleases, the API lists releases by creation date so
+// they're compared by version instead
+func getNewestRelease() (GHRelease, error) {
+	var releases []GHRelease
+	if err := getGitHub(releaseApiUrl+"?per_page=30", &releases); err != nil {
+		return GHRelease{}, err
+	}
+
+	var newest GHRelease
+	var newestVersion *semver.Version
+	for _, release := range releases {
+		if release.Draft {
+			continue
+		}
+		version, err := semver.NewVersion(strings.TrimPrefix(release.TagName, "v"))
+		if err != nil {
+			pterm.Debug.Printfln("Ignoring release %s: %s", release.TagName, err.Error())
+			continue
+		}
+		if newestVersion == nil || version.GreaterThan(newestVersion) {
+			newest, newestVersion = release, version
+		}
+	}
+	if newestVersion == nil {
+		return GHRelease{}, errors.New("no releases found")
+	}
+	return newest, nil
+}
 
-	downloadUrl := fmt.Sprintf("https://github.com/%s/%s/releases/download/%s/%s", org, repo, versionInfo.LatestVersion, filename)
-	hashResp, err := http.Get(fmt.Sprintf("%s.sha256", downloadUrl))
-	if err != nil {
-		return fmt.Errorf("error downloading hash: %s", err.Error())
+// getGitHub decodes a GitHub API response into v. Requests are made with GITHUB_TOKEN when it's set, the
+// unauthenticated rate limit is easily hit when a lot of servers start at once.
+func getGitHub(url string, v any) error {
+	headers := map[string][]string{
+		"Accept": {"application/vnd.github+json"},
 	}
-	defer hashResp.Body.Close()
-	if hashResp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error downloading hash: %s", hashResp.Status)
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		headers["Authorization"] = []string{"Bearer " + token}
 	}
-	hashBytes, err := io.ReadAll(hashResp.Body)
+	resp, err := util.DoGetWithHeaders(url, headers)
 	if err != nil {
-		return fmt.Errorf("error reading hash response: %s", err.Error())
+		return err
 	}
-	updateHash := strings.TrimSpace(string(hashBytes))
-	pterm.Debug.Println("Update Hash: ", updateHash)
+	defer resp.Body.Close()
 
-	resp, err := http.Get(downloadUrl)
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("error downloading update: %s", err.Error())
+		return fmt.Errorf("error reading response body: %s", err.Error())
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error downloading update: %s", resp.Status)
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error unmarshalling response: %s", err.Error())
 	}
+	return nil
+}
 
-	data, err := io.ReadAll(resp.Body)
+// promptForUpdate offers to update the installer before running a command
+func promptForUpdate() {
+	versionInfo, err := checkForUpdate()
 	if err != nil {
-		return fmt.Errorf("error reading update response: %s", err.Error())
+		pterm.Warning.Printfln("Error checking for installer update: %v", err)
+	}
+	if !versionInfo.UpdateAvailable {
+		return
+	}
+	pterm.Info.Printfln("Installer update available:\nCurrent version: %s\nLatest version: %s", versionInfo.CurrentVersion, versionInfo.LatestVersion)
+	pterm.Println()
+	update := util.ConfirmYN(
+		fmt.Sprintf("Do you want to update the installer to version %s?", versionInfo.LatestVersion),
+		true,
+		pterm.Info.MessageStyle,
+	)
+	if !update {
+		return
+	}
+	pterm.Info.Println("Downloading update...")
+	if err = doUpdate(versionInfo); err != nil {
+		pterm.Error.Printfln("Error updating installer: %s", err.Error())
+		return
 	}
+	pterm.Success.Println("Update successful!\nPlease restart the installer to use the new version.")
+	os.Exit(0)
+}
 
-	binHashByte := sha256.Sum256(data)
-	binHash := fmt.Sprintf("%x", binHashByte)
-
-	if updateHash != binHash {
-		return fmt.Errorf("update hash does not match")
+// runSelfUpdate updates the installer to the newest version on the -update-channel, or the -installer-version,
+// without installing a modpack
+func runSelfUpdate() {
+	if updateChannel == "none" && installerVersion == "" {
+		fail(util.ExitUsage, "Updates are turned off by the 'none' update channel, use -installer-version to pick a version")
 	}
-	err = selfupdate.Apply(bytes.NewReader(data), selfupdate.Options{})
+	versionInfo, err := checkForUpdate()
 	if err != nil {
-		return fmt.Errorf("error applying update: %s", err.Error())
+		fail(util.ExitError, err.Error())
+	}
+	if !versionInfo.UpdateAvailable {
+		pterm.Success.Printfln("The installer is up to date (%s)", versionInfo.CurrentVersion)
+		util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+		return
 	}
 
-	pterm.Success.Println("Update successful!\nPlease restart the installer to use the new version.")
-	os.Exit(0)
-	return nil
+	if !auto {
+		cont := util.ConfirmYN(fmt.Sprintf("Update the installer from %s to %s?", versionInfo.CurrentVersion, versionInfo.LatestVersion), true, pterm.Info.MessageStyle)
+		if !cont {
+			fail(util.ExitAborted, "Update cancelled")
+		}
+	}
+	pterm.Info.Printfln("Downloading installer %s...", versionInfo.LatestVersion)
+	if err = doUpdate(versionInfo); err != nil {
+		fail(util.ExitError, "Error updating installer:", err.Error())
+	}
+	pterm.Success.Printfln("Installer updated to %s", versionInfo.LatestVersion)
+	util.Emit(util.EventStatus, util.StatusEvent{Success: true, ExitCode: util.ExitOK})
+}
+
+// doUpdate replaces the installer with the release, which is refused unless its minisign signature verifies
+func doUpdate(versionInfo VersionInfo) error {
+	filename := fmt.Sprintf("ftb-server-%s-%s", strings.ToLower(runtime.GOOS), strings.ToLower(runtime.GOARCH))
+	if runtime.GOOS == "windows" {
+		filename += ".exe"
+	}
+
+	downloadUrl := fmt.Sprintf("%s/%s/%s", releaseDownloadUrl, versionInfo.LatestVersion, filename)
+	pterm.Debug.Println("Update URL:", downloadUrl)
+	return util.ApplyUpdate(downloadUrl, filename, versionInfo.LatestVersion, "")
 }
@@ -0,0 +1,427 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	BundleManifestName = "bundle.json"
+	BundleFormat       = 1
+	bundleResponsesDir = "responses"
+	// recordDrainSize is how much of a partly read response is read when it's closed to record it
+	recordDrainSize = 4096
+)
+
+// recordedHeaders are the response headers kept in a bundle, everything else is specific to the server that sent it
+var recordedHeaders = []string{"Content-Type", "Content-Disposition"}
+
+// ResponseRecorder keeps a copy of every response to a GET, HEAD or POST request so they can be replayed from a
+// bundle without network access. POSTs are told apart by their body as well as their URL.
+type ResponseRecorder struct {
+	Dir       string
+	mu        sync.Mutex
+	responses map[string]structs.BundleResponse
+}
+
+func NewResponseRecorder(dir string) (*ResponseRecorder, error) {
+	if err := os.MkdirAll(filepath.Join(dir, bundleResponsesDir), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create bundle directory: %s", err.Error())
+	}
+	return &ResponseRecorder{
+		Dir:       dir,
+		responses: map[string]structs.BundleResponse{},
+	}, nil
+}
+
+// Responses returns everything recorded so far
+func (r *ResponseRecorder) Responses() []structs.BundleResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	responses := make([]structs.BundleResponse, 0, len(r.responses))
+	for _, resp := range r.responses {
+		responses = append(responses, resp)
+	}
+	sort.Slice(responses, func(i, j int) bool {
+		return recordedKey(responses[i]) < recordedKey(responses[j])
+	})
+	return responses
+}
+
+func (r *ResponseRecorder) add(resp structs.BundleResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses[recordedKey(resp)] = resp
+}
+
+func responseKey(method, url, requestBody string) string {
+	if requestBody != "" {
+		return method + " " + url + " " + requestBody
+	}
+	return method + " " + url
+}
+
+func recordedKey(resp structs.BundleResponse) string {
+	return responseKey(resp.Method, resp.Url, resp.RequestBody)
+}
+
+// requestBodyHash returns the sha256 of the body of a POST, the body is read and put back so the request can
+// still be sent. Other requests have no body to tell them apart.
+func requestBodyHash(req *http.Request) (string, error) {
+	if req.Method != http.MethodPost || req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	b, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// recordTransport hands every GET, HEAD and POST response to a ResponseRecorder as it's read
+type recordTransport struct {
+	base     http.RoundTripper
+	recorder *ResponseRecorder
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead && req.Method != http.MethodPost {
+		return t.base.RoundTrip(req)
+	}
+	requestBody, err := requestBodyHash(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record request: %s", err.Error())
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	// A partial response can't be replayed as the whole file
+	if resp.StatusCode == http.StatusPartialContent {
+		return resp, nil
+	}
+
+	recorded := structs.BundleResponse{
+		Method:      req.Method,
+		Url:         req.URL.String(),
+		RequestBody: requestBody,
+		Status:      resp.StatusCode,
+		Header:      map[string][]string{},
+	}
+	for _, h := range recordedHeaders {
+		if v := resp.Header.Values(h); len(v) > 0 {
+			recorded.Header[h] = v
+		}
+	}
+	if req.Method == http.MethodHead {
+		t.recorder.add(recorded)
+		return resp, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(t.recorder.Dir, bundleResponsesDir), ".tmp-*")
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unable to record response: %s", err.Error())
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		recorder:   t.recorder,
+		response:   recorded,
+		tmp:        tmp,
+		hash:       sha256.New(),
+	}
+	return resp, nil
+}
+
+// recordingBody copies a response body to a temp file, it's only added to the recorder once it has been read
+// to the end so a failed download is never replayed
+type recordingBody struct {
+	io.ReadCloser
+	recorder *ResponseRecorder
+	response structs.BundleResponse
+	tmp      *os.File
+	hash     hash.Hash
+	done     bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.done {
+		if _, writeErr := io.MultiWriter(b.tmp, b.hash).Write(p[:n]); writeErr != nil {
+			return n, fmt.Errorf("unable to record response: %s", writeErr.Error())
+		}
+		b.response.Size += int64(n)
+	}
+	if err == io.EOF && !b.done {
+		b.done = true
+		if finishErr := b.finish(); finishErr != nil {
+			return n, finishErr
+		}
+	}
+	return n, err
+}
+
+func (b *recordingBody) finish() error {
+	if err := b.tmp.Close(); err != nil {
+		return err
+	}
+	b.response.Body = hex.EncodeToString(b.hash.Sum(nil))
+	dst := filepath.Join(b.recorder.Dir, bundleResponsesDir, b.response.Body)
+	if err := os.Rename(b.tmp.Name(), dst); err != nil {
+		return fmt.Errorf("unable to record response: %s", err.Error())
+	}
+	b.recorder.add(b.response)
+	return nil
+}
+
+func (b *recordingBody) Close() error {
+	// A JSON decoder stops at the end of the value and leaves the trailing newline unread, what's left of a
+	// response that was read is drained so it's still recorded. One that's given up on has too much left.
+	if !b.done && b.response.Size > 0 {
+		_, _ = io.CopyN(io.Discard, b, recordDrainSize)
+	}
+	if !b.done {
+		b.done = true
+		_ = b.tmp.Close()
+		_ = os.Remove(b.tmp.Name())
+	}
+	return b.ReadCloser.Close()
+}
+
+// Bundle is an extracted offline install bundle
+type Bundle struct {
+	Dir       string
+	Manifest  structs.BundleManifest
+	responses map[string]structs.BundleResponse
+}
+
+// OpenBundle extracts the bundle at path into dir
+func OpenBundle(path string, dir string) (*Bundle, error) {
+	if err := extractBundle(path, dir); err != nil {
+		return nil, fmt.Errorf("unable to extract bundle: %s", err.Error())
+	}
+	manifestJson, err := os.ReadFile(filepath.Join(dir, BundleManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("not an install bundle: %s", err.Error())
+	}
+	b := &Bundle{
+		Dir:       dir,
+		responses: map[string]structs.BundleResponse{},
+	}
+	if err = json.Unmarshal(manifestJson, &b.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %s", err.Error())
+	}
+	if b.Manifest.Format != BundleFormat {
+		return nil, fmt.Errorf("unsupported bundle format %d, update the installer", b.Manifest.Format)
+	}
+	for _, resp := range b.Manifest.Responses {
+		b.responses[recordedKey(resp)] = resp
+	}
+	return b, nil
+}
+
+// replayTransport answers requests from a bundle, anything that isn't in it fails instead of going to the network
+type replayTransport struct {
+	bundle *Bundle
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := requestBodyHash(req)
+	if err != nil {
+		return nil, err
+	}
+	recorded, ok := t.bundle.responses[responseKey(req.Method, req.URL.String(), requestBody)]
+	if !ok {
+		return nil, fmt.Errorf("%s %s is not in the bundle", req.Method, req.URL.String())
+	}
+
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          http.NoBody,
+		ContentLength: recorded.Size,
+		Request:       req,
+	}
+	for k, v := range recorded.Header {
+		resp.Header[k] = v
+	}
+	// Range requests are answered with the whole file, the downloader starts again when that happens
+	if req.Method != http.MethodHead && recorded.Body != "" {
+		body, err := os.Open(filepath.Join(t.bundle.Dir, bundleResponsesDir, recorded.Body))
+		if err != nil {
+			return nil, fmt.Errorf("bundle is missing the response to %s: %s", req.URL.String(), err.Error())
+		}
+		resp.Body = body
+	}
+	return resp, nil
+}
+
+// WriteBundle writes the manifest and the contents of dir to a zstd compressed tar at out
+func WriteBundle(out string, dir string, manifest structs.BundleManifest) (err error) {
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write next to the destination first so a failed bundle doesn't leave a truncated file behind
+	tmp, err := os.CreateTemp(filepath.Dir(out), ".bundle-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	zw, err := zstd.NewWriter(tmp)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:     BundleManifestName,
+		Mode:     0644,
+		Size:     int64(len(manifestJson)),
+		ModTime:  manifest.Created,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = tw.Write(manifestJson); err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == BundleManifestName || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), out)
+}
+
+func extractBundle(path string, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		dst, err := SafeJoin(dir, filepath.FromSlash(header.Name))
+		if err != nil {
+			return fmt.Errorf("bundle contains an invalid path: %s", err.Error())
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			closeErr := out.Close()
+			if err != nil {
+				return err
+			}
+			if closeErr != nil {
+				return closeErr
+			}
+		default:
+			return fmt.Errorf("bundle contains an unsupported file %s", header.Name)
+		}
+	}
+}
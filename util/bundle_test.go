@@ -0,0 +1,93 @@
+package util
+
+import (
+	"ftb-server-downloader/structs"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundleRecordReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pack.json":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"name":"pack"}`))
+		case "/unread":
+			_, _ = w.Write([]byte("never read"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	recorder, err := NewResponseRecorder(filepath.Join(dir, "content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewHTTPClient(HTTPOptions{Record: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/pack.json", "/missing"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+	// A body that isn't read to the end is a failed download and mustn't be replayed
+	resp, err := client.Get(srv.URL + "/unread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	out := filepath.Join(dir, "bundle.tar.zst")
+	manifest := structs.BundleManifest{Format: BundleFormat, Name: "pack", Responses: recorder.Responses()}
+	if err = WriteBundle(out, recorder.Dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing can come from the network once the bundle is written
+	srv.Close()
+
+	bundle, err := OpenBundle(out, filepath.Join(dir, "extracted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Manifest.Name != "pack" || len(bundle.Manifest.Responses) != 2 {
+		t.Fatalf("unexpected manifest %+v", bundle.Manifest)
+	}
+	client, err = NewHTTPClient(HTTPOptions{Replay: bundle})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = client.Get(srv.URL + "/pack.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != `{"name":"pack"}` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("replayed %q with headers %v", body, resp.Header)
+	}
+
+	resp, err = client.Get(srv.URL + "/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the recorded 404, got %d", resp.StatusCode)
+	}
+
+	if _, err = client.Get(srv.URL + "/unread"); err == nil || !strings.Contains(err.Error(), "not in the bundle") {
+		t.Errorf("expected a not in the bundle error, got %v", err)
+	}
+}
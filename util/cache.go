@@ -0,0 +1,188 @@
+package util
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// Cache is a content addressed store of downloaded files shared between installs, entries are keyed by
+// the file hash and evicted least recently used first once the cache grows past MaxSize
+type Cache struct {
+	Dir     string
+	MaxSize int64
+}
+
+// linkableExts are file types that are safe to hardlink into an install, anything else (configs etc.) is
+// copied so editing it in place on one server can't change the cached copy used by every other server
+var linkableExts = []string{".jar", ".zip", ".mrpack", ".gz", ".tgz"}
+
+func NewCache(dir string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create cache directory: %s", err.Error())
+	}
+	return &Cache{
+		Dir:     dir,
+		MaxSize: maxSize,
+	}, nil
+}
+
+func (c *Cache) entryPath(file structs.File) (string, error) {
+	if file.Hash == "" {
+		return "", errors.New("file has no hash")
+	}
+	if _, err := hex.DecodeString(file.Hash); err != nil {
+		return "", fmt.Errorf("invalid hash %s", file.Hash)
+	}
+	switch file.HashType {
+	case "sha1", "sha256":
+	default:
+		return "", fmt.Errorf("unsupported hash type: %s", file.HashType)
+	}
+	hash := strings.ToLower(file.Hash)
+	return filepath.Join(c.Dir, file.HashType, hash[:2], hash), nil
+}
+
+// Get places the cached copy of file at dest, returns false if the file isn't in the cache
+func (c *Cache) Get(file structs.File, dest string) (bool, error) {
+	entry, err := c.entryPath(file)
+	if err != nil {
+		return false, err
+	}
+	if exists, err := PathExists(entry); err != nil || !exists {
+		return false, err
+	}
+
+	// Don't trust the cache blindly, a corrupt entry is dropped and the file downloaded again
+	hash, err := FileHash(entry, file.HashType)
+	if err != nil {
+		return false, err
+	}
+	if !strings.EqualFold(hash, file.Hash) {
+		pterm.Warning.Printfln("Cached copy of %s is corrupt, removing it from the cache", file.Name)
+		_ = os.Remove(entry)
+		return false, nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return false, err
+	}
+	_ = os.Remove(dest)
+
+	linked := false
+	for _, ext := range linkableExts {
+		if strings.HasSuffix(strings.ToLower(file.Name), ext) {
+			linked = os.Link(entry, dest) == nil
+			break
+		}
+	}
+	if !linked {
+		if err = CopyFile(entry, dest); err != nil {
+			return false, err
+		}
+	}
+
+	// Bump the modification time, it's what eviction uses to find the least recently used entries
+	now := time.Now()
+	_ = os.Chtimes(entry, now, now)
+	pterm.Debug.Printfln("Using cached copy of %s (linked: %t)", file.Name, linked)
+	return true, nil
+}
+
+// Put adds a verified file to the cache
+func (c *Cache) Put(file structs.File, src string) error {
+	entry, err := c.entryPath(file)
+	if err != nil {
+		return err
+	}
+	if exists, _ := PathExists(entry); exists {
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(entry), 0755); err != nil {
+		return err
+	}
+
+	// Copy to a temp file first so other installs sharing the cache never see a half written entry
+	tmp, err := os.CreateTemp(filepath.Dir(entry), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_ = tmp.Close()
+	if err = CopyFile(src, tmp.Name()); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), entry); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+type cacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Prune evicts the least recently used entries until the cache fits in MaxSize, a MaxSize of 0 or less
+// means the cache is unbounded and only leftover temp files are removed
+func (c *Cache) Prune() (removed int, freed int64, err error) {
+	var entries []cacheEntry
+	var total int64
+	err = filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// Temp files older than an hour belong to an install that died mid copy
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			if time.Since(info.ModTime()) > time.Hour && os.Remove(path) == nil {
+				removed++
+				freed += info.Size()
+			}
+			return nil
+		}
+		entries = append(entries, cacheEntry{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return removed, freed, err
+	}
+	if c.MaxSize <= 0 {
+		return removed, freed, nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	for _, e := range entries {
+		if total <= c.MaxSize {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			pterm.Debug.Printfln("Unable to evict %s: %s", e.path, err.Error())
+			continue
+		}
+		total -= e.size
+		freed += e.size
+		removed++
+	}
+	return removed, freed, nil
+}
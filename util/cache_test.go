@@ -0,0 +1,66 @@
+package util
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewCache(filepath.Join(dir, "cache"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []structs.File
+	for i, content := range []string{"aaaaaa", "bbbbbb"} {
+		src := filepath.Join(dir, fmt.Sprintf("src%d.jar", i))
+		if err = os.WriteFile(src, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f := structs.File{Name: fmt.Sprintf("mod%d.jar", i), Hash: fmt.Sprintf("%x", sha1.Sum([]byte(content))), HashType: "sha1"}
+		if err = cache.Put(f, src); err != nil {
+			t.Fatalf("Put: %s", err)
+		}
+		files = append(files, f)
+	}
+
+	// Make the first file the most recently used
+	old := time.Now().Add(-time.Hour)
+	entry, _ := cache.entryPath(files[1])
+	_ = os.Chtimes(entry, old, old)
+	hit, err := cache.Get(files[0], filepath.Join(dir, "install", "mods", files[0].Name))
+	if err != nil || !hit {
+		t.Fatalf("got hit %t, err %v, want cache hit", hit, err)
+	}
+
+	removed, freed, err := cache.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || freed != 6 {
+		t.Errorf("got removed %d freed %d, want 1 and 6", removed, freed)
+	}
+	if hit, _ = cache.Get(files[1], filepath.Join(dir, "install", "mods", files[1].Name)); hit {
+		t.Errorf("least recently used file should have been evicted")
+	}
+	if hit, _ = cache.Get(files[0], filepath.Join(dir, "install2", "mods", files[0].Name)); !hit {
+		t.Errorf("most recently used file should still be cached")
+	}
+
+	// A corrupt entry is treated as a miss and removed
+	entry, _ = cache.entryPath(files[0])
+	_ = os.Remove(filepath.Join(dir, "install", "mods", files[0].Name))
+	_ = os.Remove(filepath.Join(dir, "install2", "mods", files[0].Name))
+	if err = os.WriteFile(entry, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if hit, _ = cache.Get(files[0], filepath.Join(dir, "install3", files[0].Name)); hit {
+		t.Errorf("corrupt entry should not be a cache hit")
+	}
+}
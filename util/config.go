@@ -0,0 +1,88 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const ConfigName = "ftb-installer.json"
+
+// FindConfig looks for an ftb-installer.json next to the installer, returns an empty string if there isn't one
+func FindConfig() string {
+	executable, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	configPath := filepath.Join(filepath.Dir(executable), ConfigName)
+	if exists, _ := PathExists(configPath); !exists {
+		return ""
+	}
+	return configPath
+}
+
+// LoadConfig reads an installer config file, unknown keys are an error so typos don't silently do nothing.
+// Relative paths in the file are relative to the folder the file is in.
+func LoadConfig(configPath string) (structs.InstallerConfig, error) {
+	var config structs.InstallerConfig
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		return config, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("invalid config %s: %s", configPath, err.Error())
+	}
+
+	if config.Channel != nil && *config.Channel != "release" && *config.Channel != "latest" {
+		return config, fmt.Errorf("invalid config %s: channel must be 'release' or 'latest'", configPath)
+	}
+	for _, pattern := range config.Exclude {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return config, fmt.Errorf("invalid config %s: bad exclude pattern %q", configPath, pattern)
+		}
+	}
+
+	configDir := filepath.Dir(configPath)
+	for _, p := range []*string{config.Dir, config.Source, config.CacheDir, config.RuntimeDir, config.CACert} {
+		if p != nil && *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(configDir, *p)
+		}
+	}
+	return config, nil
+}
+
+// ExcludeFiles removes the files matching any of the glob patterns, a pattern matching a folder excludes
+// everything in it. Returns the files to keep and the files that were excluded.
+func ExcludeFiles(files []structs.File, patterns []string) (kept []structs.File, excluded []structs.File) {
+	if len(patterns) == 0 {
+		return files, nil
+	}
+	for _, f := range files {
+		if isExcluded(filePath(f), patterns) {
+			excluded = append(excluded, f)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	return kept, excluded
+}
+
+func isExcluded(filePath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		// Check the file and every folder above it
+		for p := filePath; p != "." && p != "/"; p = path.Dir(p) {
+			if matched, _ := path.Match(pattern, p); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
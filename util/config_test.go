@@ -0,0 +1,79 @@
+package util
+
+import (
+	"ftb-server-downloader/structs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExcludeFiles(t *testing.T) {
+	files := []structs.File{
+		{Name: "jei-1.0.jar", Path: "mods"},
+		{Name: "oculus-1.0.jar", Path: "mods"},
+		{Name: "client.toml", Path: "config/oculus"},
+		{Name: "server.toml", Path: "config"},
+		{Name: "server.properties"},
+	}
+
+	var tests = []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{"no patterns", nil, []string{"mods/jei-1.0.jar", "mods/oculus-1.0.jar", "config/oculus/client.toml", "config/server.toml", "server.properties"}},
+		{"glob", []string{"mods/oculus-*.jar"}, []string{"mods/jei-1.0.jar", "config/oculus/client.toml", "config/server.toml", "server.properties"}},
+		{"folder", []string{"config/oculus/"}, []string{"mods/jei-1.0.jar", "mods/oculus-1.0.jar", "config/server.toml", "server.properties"}},
+		{"root file", []string{"server.properties"}, []string{"mods/jei-1.0.jar", "mods/oculus-1.0.jar", "config/oculus/client.toml", "config/server.toml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, excluded := ExcludeFiles(files, tt.patterns)
+			var got []string
+			for _, f := range kept {
+				got = append(got, filePath(f))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if len(kept)+len(excluded) != len(files) {
+				t.Errorf("%d kept + %d excluded != %d files", len(kept), len(excluded), len(files))
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, ConfigName)
+
+	write := func(content string) {
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"provider": "curseforge", "pack": 123, "dir": "server", "no-java": false, "memory": {"recommended": 8192}}`)
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *config.Provider != "curseforge" || *config.Pack != 123 || config.Memory.Recommended != 8192 {
+		t.Errorf("unexpected config %+v", config)
+	}
+	if config.NoJava == nil || *config.NoJava {
+		t.Errorf("no-java should be set to false")
+	}
+	if config.Version != nil {
+		t.Errorf("version should not be set")
+	}
+	if want := filepath.Join(dir, "server"); *config.Dir != want {
+		t.Errorf("dir = %s, want %s", *config.Dir, want)
+	}
+
+	write(`{"provder": "ftb"}`)
+	if _, err = LoadConfig(configPath); err == nil {
+		t.Errorf("expected an error for an unknown key")
+	}
+}
@@ -5,17 +5,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"ftb-server-downloader/structs"
 	"hash"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/pterm/pterm"
 )
 
+const (
+	partSuffix      = ".part"
+	validatorSuffix = ".validator"
+)
+
 type Download struct {
 	destPath           string
 	reqURL             string
@@ -25,8 +30,14 @@ type Download struct {
 	checkContentLength bool
 	Progress           float64
 	CancelFunc         context.CancelFunc
+	ctx                context.Context
+	progress           ProgressFunc
 }
 
+// ProgressFunc is called as a download is written with the bytes of the file on disk so far and the full
+// size of the file, total is -1 if the server didn't send a Content-Length
+type ProgressFunc func(written, total int64)
+
 func NewDownload(destPath string, reqUrl string) (*Download, error) {
 	if reqUrl == "" {
 		return nil, fmt.Errorf("required URL is empty")
@@ -35,36 +46,60 @@ func NewDownload(destPath string, reqUrl string) (*Download, error) {
 		reqURL:             reqUrl,
 		destPath:           destPath,
 		checkContentLength: false,
+		ctx:                context.Background(),
 	}, nil
 }
 
 // Do perform the file download with the configured parameters.
 // It handles directory creation, checksum verification, and cleanup on error if configured.
-// Returns an error if the download or verification fails.
+// Data is written to a .part file which is resumed with a Range request if a previous attempt failed partway.
+// The ETag or Last-Modified of the response is kept next to it and sent as If-Range, so a file that changed on
+// the server is downloaded again instead of being joined onto the old part. Without either, only downloads with
+// a checksum are resumed. Returns an error if the download or verification fails.
 func (dl *Download) Do() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	// A stalled transfer is aborted by the shared client's idle read timeout, so there's no overall limit
+	ctx, cancel := context.WithCancel(dl.ctx)
 	dl.CancelFunc = cancel
 	defer dl.Cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", dl.reqURL, nil)
+	offset, err := dl.partSize()
 	if err != nil {
 		return err
 	}
-
-	if strings.HasPrefix(dl.reqURL, "https://edge.forgecdn.net/files") {
-		req.Header.Set("x-api-key", CfApiKey)
+	validator := dl.readValidator()
+	if offset > 0 && validator == "" && dl.checksum == nil {
+		pterm.Debug.Printfln("Can't tell if %s changed since it was partly downloaded, restarting download", dl.reqURL)
+		offset = 0
 	}
-	req.Header.Set("User-Agent", UserAgent)
-	resp, err := http.DefaultClient.Do(req)
+
+	resp, err := dl.request(ctx, offset, validator)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	// The partial file is either complete or no longer matches what the server has, or the server sent a range
+	// that doesn't start where the partial file ends. Either way it can't be used, start again from scratch
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable ||
+		(offset > 0 && resp.StatusCode == http.StatusPartialContent && contentRangeStart(resp.Header.Get("Content-Range")) != offset) {
+		pterm.Debug.Printfln("Unable to resume %s from byte %d, restarting download", dl.reqURL, offset)
+		_ = resp.Body.Close()
+		if err = os.Remove(dl.partPath()); err != nil {
+			return err
+		}
+		offset = 0
+		resp, err = dl.request(ctx, offset, "")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+	}
+
 	//if resp.Header.Get("Cf-Cache-Status") != "HIT" && resp.Header.Get("Cf-Cache-Status") != "" {
 	//	pterm.Debug.Printfln("Cf-Cache-Status for %s: %s", dl.reqURL, resp.Header.Get("Cf-Cache-Status"))
 	//}
-	if resp.StatusCode != http.StatusOK {
+	// A partial response is only any use to resume from, without a Range request it's not the whole file
+	if resp.StatusCode != http.StatusOK && (resp.StatusCode != http.StatusPartialContent || offset == 0) {
 		pterm.Debug.Printfln("Headers: %+v", resp.Header)
 		return fmt.Errorf("failed to download file from %s: bad status %s", dl.reqURL, resp.Status)
 	}
@@ -73,8 +108,36 @@ func (dl *Download) Do() error {
 		return fmt.Errorf("invalid content length: %d", resp.ContentLength)
 	}
 
-	b := resp.Body
-	err = dl.write(b)
+	resume := false
+	if offset > 0 {
+		if resp.StatusCode == http.StatusPartialContent {
+			resume = true
+			pterm.Debug.Printfln("Resuming download of %s from byte %d", dl.reqURL, offset)
+		} else {
+			// Server ignored the Range header or the file changed (If-Range), the body is the whole file
+			pterm.Debug.Printfln("Server didn't resume %s, restarting download", dl.reqURL)
+		}
+	}
+	if !resume {
+		if err = dl.writeValidator(resp.Header); err != nil {
+			return err
+		}
+	}
+
+	var b io.ReadCloser = resp.Body
+	if dl.progress != nil {
+		var written int64
+		if resume {
+			written = offset
+		}
+		total := int64(-1)
+		if resp.ContentLength > 0 {
+			total = written + resp.ContentLength
+		}
+		dl.progress(written, total)
+		b = &progressReader{ReadCloser: resp.Body, written: written, total: total, fn: dl.progress}
+	}
+	err = dl.write(b, resume)
 	if err != nil {
 		return err
 	}
@@ -82,7 +145,26 @@ func (dl *Download) Do() error {
 	return nil
 }
 
-func (dl *Download) write(b io.ReadCloser) error {
+func (dl *Download) request(ctx context.Context, offset int64, validator string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", dl.reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(dl.reqURL, "https://edge.forgecdn.net/files") {
+		req.Header.Set("x-api-key", CfApiKey)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+	return HTTPClient().Do(req)
+}
+
+func (dl *Download) write(b io.ReadCloser, resume bool) error {
 	// Check if the destination directory exists
 	destDir := filepath.Dir(dl.destPath)
 	if _, err := os.Stat(destDir); errors.Is(err, os.ErrNotExist) {
@@ -92,18 +174,36 @@ func (dl *Download) write(b io.ReadCloser) error {
 		}
 	}
 
-	f, err := os.OpenFile(dl.destPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_RDWR | os.O_CREATE
+	}
+	f, err := os.OpenFile(dl.partPath(), flags, 0644)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
+	if dl.hash != nil {
+		dl.hash.Reset()
+		// Hash the data we already have so the checksum covers the whole file
+		if resume {
+			if _, err = io.Copy(dl.hash, f); err != nil {
+				return fmt.Errorf("failed to hash partial file: %s", err.Error())
+			}
+		}
+	}
+	if _, err = f.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
 	var writer io.Writer = f
 
 	if dl.hash != nil {
 		writer = io.MultiWriter(f, dl.hash)
 	}
 
+	// On failure the .part file is kept so the next attempt can resume from where this one stopped
 	if _, err = io.Copy(writer, b); err != nil {
 		return fmt.Errorf("failed to write file: %s", err.Error())
 	}
@@ -111,15 +211,102 @@ func (dl *Download) write(b io.ReadCloser) error {
 	if dl.hash != nil && dl.checksum != nil {
 		sum := dl.hash.Sum(nil)
 		if !bytes.Equal(dl.checksum, sum) {
+			// A bad partial file can never be resumed into a good one, so it never stays as a .part
+			_ = f.Close()
+			_ = os.Remove(dl.validatorPath())
 			if dl.deleteOnError {
-				if err := os.Remove(dl.destPath); err != nil {
+				if err := os.Remove(dl.partPath()); err != nil {
 					return fmt.Errorf("checksum mismatch, failed to remove file: %s", err.Error())
 				}
+			} else {
+				_ = os.Rename(dl.partPath(), dl.destPath)
 			}
 			return fmt.Errorf("checksum mismatch")
 		}
 	}
-	return nil
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+	_ = os.Remove(dl.validatorPath())
+	return os.Rename(dl.partPath(), dl.destPath)
+}
+
+type progressReader struct {
+	io.ReadCloser
+	written int64
+	total   int64
+	fn      ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.written += int64(n)
+		r.fn(r.written, r.total)
+	}
+	return n, err
+}
+
+func (dl *Download) partPath() string {
+	return dl.destPath + partSuffix
+}
+
+func (dl *Download) validatorPath() string {
+	return dl.partPath() + validatorSuffix
+}
+
+// readValidator returns the If-Range value saved for the .part file, or "" if there isn't one
+func (dl *Download) readValidator() string {
+	b, err := os.ReadFile(dl.validatorPath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// writeValidator saves what identifies the version of the file being downloaded, weak ETags can't be used
+// with If-Range so Last-Modified is used instead
+func (dl *Download) writeValidator(header http.Header) error {
+	validator := header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = header.Get("Last-Modified")
+	}
+	if validator == "" {
+		err := os.Remove(dl.validatorPath())
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dl.destPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dl.validatorPath(), []byte(validator), 0644)
+}
+
+// partSize returns the size of any partial download left by a previous attempt
+func (dl *Download) partSize() (int64, error) {
+	info, err := os.Stat(dl.partPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// contentRangeStart returns the first byte position from a Content-Range header, or -1 if it can't be parsed
+func contentRangeStart(contentRange string) int64 {
+	var start, end, size int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &size); err == nil {
+		return start
+	}
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/*", &start, &end); err == nil {
+		return start
+	}
+	return -1
 }
 
 func (dl *Download) CheckContentLength(check bool) {
@@ -132,8 +319,51 @@ func (dl *Download) SetChecksum(hash hash.Hash, sum []byte, deleteOnError bool)
 	dl.deleteOnError = deleteOnError
 }
 
+// SetProgressFunc sets a function to report the progress of the download to
+func (dl *Download) SetProgressFunc(fn ProgressFunc) {
+	dl.progress = fn
+}
+
+// SetContext sets the parent context of the download, cancelling it stops the download
+func (dl *Download) SetContext(ctx context.Context) {
+	dl.ctx = ctx
+}
+
 func (dl *Download) Cancel() {
 	if dl.CancelFunc != nil {
 		dl.CancelFunc()
 	}
 }
+
+// FileDownloadError is a file that failed to download
+type FileDownloadError struct {
+	File structs.File
+	Err  error
+}
+
+func (e FileDownloadError) Error() string {
+	return fmt.Sprintf("%s: %s", filepath.Join(e.File.Path, e.File.Name), e.Err.Error())
+}
+
+func (e FileDownloadError) Unwrap() error {
+	return e.Err
+}
+
+// DownloadErrors collects every file that failed in a batch of downloads
+type DownloadErrors []FileDownloadError
+
+func (e DownloadErrors) Error() string {
+	lines := []string{fmt.Sprintf("%d file(s) failed to download:", len(e))}
+	for _, fileErr := range e {
+		lines = append(lines, "  "+fileErr.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e DownloadErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fileErr := range e {
+		errs[i] = fileErr
+	}
+	return errs
+}
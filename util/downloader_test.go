@@ -0,0 +1,188 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadResume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	sum := sha256.Sum256(content)
+
+	var tests = []struct {
+		name        string
+		partial     []byte
+		honourRange bool
+		checksum    []byte
+		wantErr     bool
+		wantRange   string
+	}{
+		{"fresh download", nil, true, sum[:], false, ""},
+		{"resume with range", content[:4000], true, sum[:], false, "bytes=4000-"},
+		{"server ignores range", content[:4000], false, sum[:], false, "bytes=4000-"},
+		{"corrupt partial file", bytes.Repeat([]byte("x"), 4000), true, sum[:], true, "bytes=4000-"},
+		{"partial file larger than content", append(content, 'x'), true, sum[:], false, "bytes=10001-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRange string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") != "" {
+					gotRange = r.Header.Get("Range")
+				}
+				if !tt.honourRange {
+					_, _ = w.Write(content)
+					return
+				}
+				http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+			}))
+			defer srv.Close()
+
+			dest := filepath.Join(t.TempDir(), "file.jar")
+			if tt.partial != nil {
+				if err := os.WriteFile(dest+".part", tt.partial, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dl, err := NewDownload(dest, srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dl.SetChecksum(sha256.New(), tt.checksum, true)
+			err = dl.Do()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if gotRange != tt.wantRange {
+				t.Errorf("got range %q, want %q", gotRange, tt.wantRange)
+			}
+			if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+				t.Errorf(".part file should not exist after download finished")
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("downloaded content does not match")
+			}
+		})
+	}
+}
+
+func TestDownloadWrongRange(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	sum := sha256.Sum256(content)
+
+	// The server answers the Range request with a range that doesn't start where the part ends
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") != "" {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 2000-%d/%d", len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[2000:])
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "file.jar")
+	if err := os.WriteFile(dest+".part", content[:4000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	dl, err := NewDownload(dest, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl.SetChecksum(sha256.New(), sum[:], true)
+	if err = dl.Do(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bytes=4000-", ""}; !reflect.DeepEqual(ranges, want) {
+		t.Errorf("got ranges %q, want %q", ranges, want)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded content does not match")
+	}
+}
+
+func TestDownloadIfRange(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+
+	var tests = []struct {
+		name      string
+		validator string
+		wantRange string
+	}{
+		{"no validator", "", ""},
+		{"unchanged file", `"v2"`, "bytes=4000-"},
+		{"changed file", `"v1"`, "bytes=4000-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRange string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRange = r.Header.Get("Range")
+				w.Header().Set("ETag", `"v2"`)
+				http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+			}))
+			defer srv.Close()
+
+			// The part is from an older version of the file unless the validator matches
+			dest := filepath.Join(t.TempDir(), "file.jar")
+			partial := bytes.Repeat([]byte("x"), 4000)
+			if tt.validator == `"v2"` {
+				partial = content[:4000]
+			}
+			if err := os.WriteFile(dest+".part", partial, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.validator != "" {
+				if err := os.WriteFile(dest+".part.validator", []byte(tt.validator), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Without a checksum nothing else would notice a stale part
+			dl, err := NewDownload(dest, srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = dl.Do(); err != nil {
+				t.Fatal(err)
+			}
+			if gotRange != tt.wantRange {
+				t.Errorf("got range %q, want %q", gotRange, tt.wantRange)
+			}
+			got, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("downloaded content does not match")
+			}
+			if _, err := os.Stat(dest + ".part.validator"); !os.IsNotExist(err) {
+				t.Errorf(".part.validator file should not exist after download finished")
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package util
+
+import (
+	"encoding/json"
+	"ftb-server-downloader/structs"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Exit codes used by the installer, these are part of the -output json contract and must not change
+const (
+	ExitOK               = 0 // Install finished successfully
+	ExitError            = 1 // Unexpected error that doesn't fit any of the codes below
+	ExitUsage            = 2 // Invalid flags or command
+	ExitAborted          = 3 // The user declined to continue, or -force is needed to continue
+	ExitResolveFailed    = 4 // The modpack, version, modloader or java download could not be resolved
+	ExitDownloadFailed   = 5 // One or more files failed to download
+	ExitJavaFailed       = 6 // The java archive could not be extracted
+	ExitModloaderFailed  = 7 // The modloader installer failed
+	ExitValidationFailed = 8 // Files failed validation and could not be repaired
+	ExitInstallFailed    = 9 // Writing the install to disk (update, overrides, manifest) failed
+)
+
+// Event names written by -output json, these are part of the -output json contract and must not change
+const (
+	EventPackResolved   = "pack_resolved"   // PackResolvedEvent
+	EventFilesPlanned   = "files_planned"   // FilesPlannedEvent
+	EventLocalEdits     = "local_edits"     // LocalEditsEvent
+	EventDownloadStart  = "download_start"  // DownloadEvent
+	EventDownloadFinish = "download_finish" // DownloadEvent
+	EventDownloadFail   = "download_fail"   // DownloadEvent
+	EventJavaExtracted  = "java_extracted"  // JavaExtractedEvent
+	EventModloaderStart = "modloader_start" // ModloaderEvent
+	EventModloaderExit  = "modloader_exit"  // ModloaderEvent
+	EventValidation     = "validation"      // ValidationEvent
+	EventConfig         = "config"          // ConfigEvent
+	EventStatus         = "status"          // StatusEvent, always the last event written
+)
+
+// Event is a single line of the -output json stream. Data holds one of the *Event structs below
+type Event struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data"`
+}
+
+type PackResolvedEvent struct {
+	Provider         string `json:"provider"`
+	PackId           int    `json:"pack_id"`
+	PackName         string `json:"pack_name"`
+	VersionId        int    `json:"version_id"`
+	VersionName      string `json:"version_name"`
+	McVersion        string `json:"mc_version"`
+	ModLoader        string `json:"modloader"`
+	ModLoaderVersion string `json:"modloader_version"`
+	JavaVersion      string `json:"java_version"`
+	InstallDir       string `json:"install_dir"`
+}
+
+type FilesPlannedEvent struct {
+	IsUpdate   bool  `json:"is_update"`
+	Files      int   `json:"files"`
+	TotalBytes int64 `json:"total_bytes"`
+	Unchanged  int   `json:"unchanged"`
+	Updated    int   `json:"updated"`
+	Removed    int   `json:"removed"`
+	Edited     int   `json:"edited"`
+}
+
+// LocalEditsEvent is what an update did with the files changed since they were installed, depending on the
+// -local-edits policy. Kept and Conflicts have the new version next to them as <file>.new, Conflicts also have
+// the version they were installed as in <file>.orig.
+type LocalEditsEvent struct {
+	Policy      string   `json:"policy"`
+	Overwritten []string `json:"overwritten"`
+	Kept        []string `json:"kept"`
+	Merged      []string `json:"merged"`
+	Conflicts   []string `json:"conflicts"`
+}
+
+type DownloadEvent struct {
+	Path   string `json:"path"`
+	Url    string `json:"url"`
+	Size   int64  `json:"size"`
+	Cached bool   `json:"cached"`
+	Error  string `json:"error,omitempty"`
+}
+
+type JavaExtractedEvent struct {
+	JavaVersion string `json:"java_version"`
+	Path        string `json:"path"`
+}
+
+type ModloaderEvent struct {
+	Name     string `json:"name"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// ValidationEvent lists the files that don't match the manifest. Invalid is Missing and Modified together,
+// the files a repair downloads again. Extra are untracked files in the folders the pack installs into.
+type ValidationEvent struct {
+	Checked  int      `json:"checked"`
+	Invalid  []string `json:"invalid"`
+	Missing  []string `json:"missing"`
+	Modified []string `json:"modified"`
+	Extra    []string `json:"extra"`
+	Repaired bool     `json:"repaired"`
+}
+
+// ConfigEvent is the config dump, File is the config file that was read or empty if there isn't one
+type ConfigEvent struct {
+	File   string                  `json:"file"`
+	Config structs.InstallerConfig `json:"config"`
+}
+
+type StatusEvent struct {
+	Success  bool   `json:"success"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+var (
+	eventsMu  sync.Mutex
+	eventsOut io.Writer
+
+	// CmdOutput is where the output of the modloader installers goes, stdout is kept for the event stream with -output json
+	CmdOutput io.Writer = os.Stdout
+)
+
+// EnableEvents writes every emitted event to w as newline delimited JSON
+func EnableEvents(w io.Writer) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	eventsOut = w
+}
+
+// EventsEnabled reports if -output json is in use
+func EventsEnabled() bool {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	return eventsOut != nil
+}
+
+// Emit writes an event to the event stream, it does nothing unless EnableEvents has been called
+func Emit(event string, data any) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if eventsOut == nil {
+		return
+	}
+	b, err := json.Marshal(Event{Event: event, Time: time.Now().UTC(), Data: data})
+	if err != nil {
+		return
+	}
+	_, _ = eventsOut.Write(append(b, '\n'))
+}
@@ -0,0 +1,239 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPOptions configures the HTTP client shared by every request the installer makes
+type HTTPOptions struct {
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// IdleReadTimeout aborts a response body that hasn't received any data for this long, so a stalled
+	// transfer fails and can be retried instead of hanging
+	IdleReadTimeout time.Duration
+	// Proxy is the proxy URL to use, when empty HTTPS_PROXY/HTTP_PROXY/NO_PROXY are used
+	Proxy string
+	// CACertFile is a PEM bundle of extra certificate authorities to trust, e.g. for a TLS intercepting proxy
+	CACertFile string
+	// Mirrors rewrites request URLs, a URL starting with a key has that prefix replaced with the value
+	Mirrors map[string]string
+	// Record keeps a copy of every response for an offline bundle
+	Record *ResponseRecorder
+	// Replay answers every request from a bundle instead of the network, the other options are ignored
+	Replay *Bundle
+}
+
+var DefaultHTTPOptions = HTTPOptions{
+	DialTimeout:           30 * time.Second,
+	TLSHandshakeTimeout:   30 * time.Second,
+	ResponseHeaderTimeout: 60 * time.Second,
+	IdleReadTimeout:       120 * time.Second,
+}
+
+var (
+	httpClientMu sync.Mutex
+	httpClient   *http.Client
+	replaying    bool
+)
+
+// SetHTTPOptions replaces the shared HTTP client with one built from opts
+func SetHTTPOptions(opts HTTPOptions) error {
+	client, err := NewHTTPClient(opts)
+	if err != nil {
+		return err
+	}
+	httpClientMu.Lock()
+	defer httpClientMu.Unlock()
+	httpClient = client
+	replaying = opts.Replay != nil
+	return nil
+}
+
+// Replaying reports if requests are answered from a bundle, API keys aren't needed for those
+func Replaying() bool {
+	httpClientMu.Lock()
+	defer httpClientMu.Unlock()
+	return replaying
+}
+
+// HTTPClient returns the shared HTTP client, every request should go through it
+func HTTPClient() *http.Client {
+	httpClientMu.Lock()
+	defer httpClientMu.Unlock()
+	if httpClient == nil {
+		// The defaults have no proxy, CA or mirrors so they can't fail
+		httpClient, _ = NewHTTPClient(DefaultHTTPOptions)
+	}
+	return httpClient
+}
+
+func NewHTTPClient(opts HTTPOptions) (*http.Client, error) {
+	if opts.Replay != nil {
+		return &http.Client{Transport: &replayTransport{bundle: opts.Replay}}, nil
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+
+	if opts.Proxy != "" {
+		proxyUrl, err := url.Parse(opts.Proxy)
+		if err != nil || proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url %s", opts.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	if opts.CACertFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA certificate: %s", err.Error())
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CACertFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	var rt http.RoundTripper = transport
+	if opts.IdleReadTimeout > 0 {
+		rt = &idleTimeoutTransport{base: rt, timeout: opts.IdleReadTimeout}
+	}
+	if len(opts.Mirrors) > 0 {
+		mirrors, err := newMirrorTransport(rt, opts.Mirrors)
+		if err != nil {
+			return nil, err
+		}
+		rt = mirrors
+	}
+	// Recorded outside the mirrors so the bundle has the URLs the installer asked for
+	if opts.Record != nil {
+		rt = &recordTransport{base: rt, recorder: opts.Record}
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+type mirrorRule struct {
+	from string
+	to   *url.URL
+}
+
+// mirrorTransport sends requests for a mirrored URL to the mirror instead
+type mirrorTransport struct {
+	base  http.RoundTripper
+	rules []mirrorRule
+}
+
+func newMirrorTransport(base http.RoundTripper, mirrors map[string]string) (*mirrorTransport, error) {
+	t := &mirrorTransport{base: base}
+	for from, to := range mirrors {
+		toUrl, err := url.Parse(to)
+		if err != nil || toUrl.Scheme == "" || toUrl.Host == "" {
+			return nil, fmt.Errorf("invalid mirror url %s", to)
+		}
+		if from == "" {
+			return nil, errors.New("mirror rule is missing the url to replace")
+		}
+		t.rules = append(t.rules, mirrorRule{from: from, to: toUrl})
+	}
+	// The most specific rule wins
+	sort.Slice(t.rules, func(i, j int) bool {
+		return len(t.rules[i].from) > len(t.rules[j].from)
+	})
+	return t, nil
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqUrl := req.URL.String()
+	for _, rule := range t.rules {
+		if !strings.HasPrefix(reqUrl, rule.from) {
+			continue
+		}
+		// Only match whole path segments, https://maven.example.com shouldn't match https://maven.example.com.evil
+		rest := strings.TrimPrefix(reqUrl, rule.from)
+		if rest != "" && !strings.HasSuffix(rule.from, "/") && !strings.HasPrefix(rest, "/") {
+			continue
+		}
+		rewritten, err := url.Parse(strings.TrimSuffix(rule.to.String(), "/") + "/" + strings.TrimPrefix(rest, "/"))
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.URL = rewritten
+		req.Host = ""
+		break
+	}
+	return t.base.RoundTrip(req)
+}
+
+// idleTimeoutTransport cancels a request when its response body stops receiving data
+type idleTimeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *idleTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	body := &idleTimeoutBody{ReadCloser: resp.Body, timeout: t.timeout, cancel: cancel}
+	body.timer = time.AfterFunc(t.timeout, func() {
+		body.timedOut.Store(true)
+		cancel()
+	})
+	resp.Body = body
+	return resp, nil
+}
+
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+	cancel   context.CancelFunc
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	if err != nil && err != io.EOF && b.timedOut.Load() {
+		return n, fmt.Errorf("no data received for %s: %s", b.timeout, err.Error())
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
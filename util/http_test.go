@@ -0,0 +1,122 @@
+package util
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdleReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		// Stall without closing the connection
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client, err := NewHTTPClient(HTTPOptions{
+		DialTimeout:           time.Second,
+		TLSHandshakeTimeout:   time.Second,
+		ResponseHeaderTimeout: time.Second,
+		IdleReadTimeout:       200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	start := time.Now()
+	_, err = io.ReadAll(resp.Body)
+	if err == nil || !strings.Contains(err.Error(), "no data received") {
+		t.Fatalf("expected an idle timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("stalled read took %s to time out", elapsed)
+	}
+}
+
+func TestMirrors(t *testing.T) {
+	var gotPath string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = w.Write([]byte("mirrored"))
+	}))
+	defer mirror.Close()
+
+	client, err := NewHTTPClient(HTTPOptions{
+		Mirrors: map[string]string{
+			"https://maven.example.com":       mirror.URL + "/repository/maven",
+			"https://maven.example.com/forge": mirror.URL + "/repository/forge",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		url  string
+		want string
+	}{
+		{"https://maven.example.com/net/foo/1.0/foo-1.0.jar", "/repository/maven/net/foo/1.0/foo-1.0.jar"},
+		{"https://maven.example.com/forge/net/foo/foo.jar", "/repository/forge/net/foo/foo.jar"},
+	}
+	for _, tt := range tests {
+		gotPath = ""
+		resp, err := client.Get(tt.url)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.url, err)
+		}
+		_ = resp.Body.Close()
+		if gotPath != tt.want {
+			t.Errorf("%s requested %s from the mirror, want %s", tt.url, gotPath, tt.want)
+		}
+	}
+}
+
+func TestCACertFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// Without the server's certificate the request has to fail
+	client, err := NewHTTPClient(HTTPOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Get(srv.URL); err == nil {
+		t.Fatal("expected a certificate error without the CA certificate")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err = os.WriteFile(caFile, certPem, 0644); err != nil {
+		t.Fatal(err)
+	}
+	client, err = NewHTTPClient(HTTPOptions{CACertFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,443 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codeclysm/extract/v4"
+	semVer "github.com/hashicorp/go-version"
+)
+
+const (
+	adoptiumApiUrl  = "https://api.adoptium.net"
+	zuluApiUrl      = "https://api.azul.com/metadata/v1/zulu/packages"
+	libericaApiUrl  = "https://api.bell-sw.com/v1/liberica/releases"
+	microsoftJdkUrl = "https://aka.ms/download-jdk"
+	graalVMUrl      = "https://download.oracle.com/graalvm"
+)
+
+// JavaProviders are the names accepted by GetJavaProvider
+var JavaProviders = []string{"adoptium", "zulu", "microsoft", "liberica", "graalvm"}
+
+// JavaProvider finds the java download for a platform, goos and goarch use the same names as GOOS and GOARCH.
+// The file returned must have a hash so the download can be verified.
+type JavaProvider interface {
+	GetJava(version string, goos string, goarch string) (structs.File, error)
+}
+
+func GetJavaProvider(name string) (JavaProvider, error) {
+	switch name {
+	case "adoptium", "":
+		return Adoptium{}, nil
+	case "zulu":
+		return Zulu{}, nil
+	case "microsoft":
+		return Microsoft{}, nil
+	case "liberica":
+		return Liberica{}, nil
+	case "graalvm":
+		return GraalVM{}, nil
+	default:
+		return nil, fmt.Errorf("unknown java provider '%s', valid providers are %s", name, strings.Join(JavaProviders, ", "))
+	}
+}
+
+// Adoptium gets the Eclipse Temurin JRE
+type Adoptium struct{}
+
+func (a Adoptium) GetJava(version string, goos string, goarch string) (structs.File, error) {
+	adoptiumUrl, err := makeAdoptiumUrl(version, goos, goarch)
+	if err != nil {
+		return structs.File{}, err
+	}
+
+	get, err := DoGet(adoptiumUrl)
+	if err != nil {
+		return structs.File{}, err
+	}
+	defer get.Body.Close()
+
+	var adoptium structs.Adoptium
+
+	err = json.NewDecoder(get.Body).Decode(&adoptium)
+	if err != nil {
+		return structs.File{}, err
+	}
+	if len(adoptium) == 0 || len(adoptium[0].Binaries) == 0 {
+		return structs.File{}, fmt.Errorf("adoptium has no java %s build for %s/%s", version, goos, goarch)
+	}
+
+	pkg := adoptium[0].Binaries[0].Package
+	return javaFile(pkg.Link, pkg.Name, pkg.Checksum, "sha256", int64(pkg.Size))
+}
+
+func makeAdoptiumUrl(version string, goos string, goarch string) (string, error) {
+	versionRange := version
+	// A bare major version (e.g. "21") is turned into a range so we get the latest build of that major
+	if major, err := strconv.Atoi(version); err == nil {
+		versionRange = fmt.Sprintf("[%d,%d)", major, major+1)
+	}
+	parsedUrl, err := url.Parse(adoptiumApiUrl + "/v3/assets/version/" + url.PathEscape(versionRange))
+	if err != nil {
+		return "", err
+	}
+
+	q := parsedUrl.Query()
+	q.Add("heap_size", "normal")
+	q.Add("image_type", "jre")
+	q.Add("page", "0")
+	q.Add("page_size", "10")
+	q.Add("project", "jdk")
+	q.Add("release_type", "ga")
+	q.Add("semver", "false")
+	q.Add("sort_method", "DEFAULT")
+	q.Add("sort_order", "DESC")
+	q.Add("vendor", "eclipse")
+	if goos == "windows" {
+		q.Add("os", "windows")
+	}
+	if goos == "darwin" {
+		q.Add("os", "mac")
+	}
+	if goos == "linux" {
+		if isMusl(goos) {
+			q.Add("os", "alpine-linux")
+		} else {
+			q.Add("os", "linux")
+		}
+	}
+
+	arch, err := validJavaArch(version, goos, goarch)
+	if err != nil {
+		return "", err
+	}
+	q.Add("architecture", arch)
+
+	parsedUrl.RawQuery = q.Encode()
+
+	return parsedUrl.String(), nil
+}
+
+func validJavaArch(version string, goos string, goarch string) (string, error) {
+	targetVersion, err := semVer.NewVersion(version)
+	if err != nil {
+		return "", err
+	}
+	switch goos {
+	case "darwin":
+		if goarch == "arm64" {
+			limit, err := semVer.NewVersion("11.0.0")
+			if err != nil {
+				return "", err
+			}
+			if targetVersion.LessThan(limit) {
+				return "x64", nil
+			}
+			return "aarch64", nil
+		}
+		if goarch == "amd64" {
+			return "x64", nil
+		}
+		if goarch == "386" {
+			return "x86", nil
+		}
+	case "windows":
+		if goarch == "amd64" || goarch == "arm64" {
+			return "x64", nil
+		}
+		if goarch == "386" || goarch == "arm" {
+			return "x86", nil
+		}
+	case "linux":
+		if goarch == "amd64" {
+			return "x64", nil
+		}
+		if goarch == "386" {
+			return "x86", nil
+		}
+		if goarch == "arm64" {
+			return "aarch64", nil
+		}
+		if goarch == "arm" {
+			return "arm", nil
+		}
+	}
+	return "", errors.New("unsupported architecture, please contact FTB support")
+}
+
+// Zulu gets the Azul Zulu JRE, falling back to the JDK for platforms that don't have a JRE build
+type Zulu struct{}
+
+func (z Zulu) GetJava(version string, goos string, goarch string) (structs.File, error) {
+	major, err := javaMajor(version)
+	if err != nil {
+		return structs.File{}, err
+	}
+	osName := map[string]string{"linux": "linux", "darwin": "macos", "windows": "windows"}[goos]
+	if isMusl(goos) {
+		osName = "linux-musl"
+	}
+	arch := map[string]string{"amd64": "x64", "386": "x86", "arm64": "aarch64", "arm": "aarch32hf"}[goarch]
+	if osName == "" || arch == "" {
+		return structs.File{}, fmt.Errorf("zulu doesn't support %s/%s", goos, goarch)
+	}
+
+	for _, packageType := range []string{"jre", "jdk"} {
+		q := url.Values{}
+		q.Add("java_version", strconv.Itoa(major))
+		q.Add("os", osName)
+		q.Add("arch", arch)
+		q.Add("archive_type", archiveType(goos))
+		q.Add("java_package_type", packageType)
+		q.Add("javafx_bundled", "false")
+		q.Add("release_status", "ga")
+		q.Add("availability_types", "CA")
+		q.Add("latest", "true")
+		q.Add("page", "1")
+		q.Add("page_size", "1")
+
+		var packages []structs.ZuluPackage
+		if err = getJson(zuluApiUrl+"/?"+q.Encode(), &packages); err != nil {
+			return structs.File{}, err
+		}
+		if len(packages) == 0 {
+			continue
+		}
+
+		// The checksum is only in the package details
+		var details structs.ZuluPackage
+		if err = getJson(zuluApiUrl+"/"+url.PathEscape(packages[0].PackageUuid), &details); err != nil {
+			return structs.File{}, err
+		}
+		return javaFile(details.DownloadUrl, details.Name, details.Sha256Hash, "sha256", details.Size)
+	}
+	return structs.File{}, fmt.Errorf("zulu has no java %d build for %s/%s", major, goos, goarch)
+}
+
+// Liberica gets the BellSoft Liberica JRE
+type Liberica struct{}
+
+func (l Liberica) GetJava(version string, goos string, goarch string) (structs.File, error) {
+	major, err := javaMajor(version)
+	if err != nil {
+		return structs.File{}, err
+	}
+	osName := map[string]string{"linux": "linux", "darwin": "macos", "windows": "windows"}[goos]
+	if isMusl(goos) {
+		osName = "linux-musl"
+	}
+	arch := map[string]string{"amd64": "x86", "386": "x86", "arm64": "arm", "arm": "arm"}[goarch]
+	bitness := "64"
+	if goarch == "386" || goarch == "arm" {
+		bitness = "32"
+	}
+	if osName == "" || arch == "" {
+		return structs.File{}, fmt.Errorf("liberica doesn't support %s/%s", goos, goarch)
+	}
+
+	q := url.Values{}
+	q.Add("version-feature", strconv.Itoa(major))
+	q.Add("version-modifier", "latest")
+	q.Add("os", osName)
+	q.Add("arch", arch)
+	q.Add("bitness", bitness)
+	q.Add("package-type", archiveType(goos))
+	q.Add("bundle-type", "jre")
+	q.Add("fields", "downloadUrl,filename,sha1,size")
+
+	var releases []structs.LibericaRelease
+	if err = getJson(libericaApiUrl+"?"+q.Encode(), &releases); err != nil {
+		return structs.File{}, err
+	}
+	if len(releases) == 0 {
+		return structs.File{}, fmt.Errorf("liberica has no java %d build for %s/%s", major, goos, goarch)
+	}
+	return javaFile(releases[0].DownloadUrl, releases[0].Filename, releases[0].Sha1, "sha1", releases[0].Size)
+}
+
+// Microsoft gets the Microsoft Build of OpenJDK, only JDKs of the LTS versions are published
+type Microsoft struct{}
+
+func (m Microsoft) GetJava(version string, goos string, goarch string) (structs.File, error) {
+	major, err := javaMajor(version)
+	if err != nil {
+		return structs.File{}, err
+	}
+	osName := map[string]string{"linux": "linux", "darwin": "macos", "windows": "windows"}[goos]
+	arch := map[string]string{"amd64": "x64", "arm64": "aarch64"}[goarch]
+	if osName == "" || arch == "" {
+		return structs.File{}, fmt.Errorf("microsoft doesn't support %s/%s", goos, goarch)
+	}
+
+	name := fmt.Sprintf("microsoft-jdk-%d-%s-%s.%s", major, osName, arch, archiveType(goos))
+	link := microsoftJdkUrl + "/" + name
+	checksum, err := getChecksum(link + ".sha256sum.txt")
+	if err != nil {
+		return structs.File{}, fmt.Errorf("microsoft has no java %d build for %s/%s: %s", major, goos, goarch, err.Error())
+	}
+	return javaFile(link, name, checksum, "sha256", 0)
+}
+
+// GraalVM gets Oracle GraalVM, which is only published as a JDK from java 17
+type GraalVM struct{}
+
+func (g GraalVM) GetJava(version string, goos string, goarch string) (structs.File, error) {
+	major, err := javaMajor(version)
+	if err != nil {
+		return structs.File{}, err
+	}
+	osName := map[string]string{"linux": "linux", "darwin": "macos", "windows": "windows"}[goos]
+	arch := map[string]string{"amd64": "x64", "arm64": "aarch64"}[goarch]
+	if osName == "" || arch == "" {
+		return structs.File{}, fmt.Errorf("graalvm doesn't support %s/%s", goos, goarch)
+	}
+
+	name := fmt.Sprintf("graalvm-jdk-%d_%s-%s_bin.%s", major, osName, arch, archiveType(goos))
+	link := fmt.Sprintf("%s/%d/latest/%s", graalVMUrl, major, name)
+	checksum, err := getChecksum(link + ".sha256")
+	if err != nil {
+		return structs.File{}, fmt.Errorf("graalvm has no java %d build for %s/%s: %s", major, goos, goarch, err.Error())
+	}
+	return javaFile(link, name, checksum, "sha256", 0)
+}
+
+// javaFile is the download for a java archive, name is the archive's file name which is used for its type
+func javaFile(link string, name string, checksum string, hashType string, size int64) (structs.File, error) {
+	if checksum == "" {
+		return structs.File{}, fmt.Errorf("no checksum for %s", link)
+	}
+	var fileExt string
+	if strings.HasSuffix(name, ".zip") {
+		fileExt = ".zip"
+	} else if strings.HasSuffix(name, ".tar.gz") {
+		fileExt = ".tar.gz"
+	} else {
+		fileExt = "" // shrug
+	}
+
+	return structs.File{
+		Name:     "jre" + fileExt,
+		Path:     "",
+		Url:      link,
+		Hash:     strings.ToLower(checksum),
+		HashType: hashType,
+		Size:     size,
+	}, nil
+}
+
+// javaMajor gets the major version from a java version, "1.8.0_392" is 8 and "21.0.1+12" is 21
+func javaMajor(version string) (int, error) {
+	segments := strings.FieldsFunc(version, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if len(segments) == 0 {
+		return 0, fmt.Errorf("invalid java version %s", version)
+	}
+	if segments[0] == "1" && len(segments) > 1 {
+		segments = segments[1:]
+	}
+	return strconv.Atoi(segments[0])
+}
+
+func archiveType(goos string) string {
+	if goos == "windows" {
+		return "zip"
+	}
+	return "tar.gz"
+}
+
+// isMusl reports if the java for goos needs to be built against musl, only the machine we're running on can
+// be checked for alpine
+func isMusl(goos string) bool {
+	if goos != "linux" || runtime.GOOS != "linux" {
+		return false
+	}
+	_, err := os.Stat("/etc/alpine-release")
+	return err == nil
+}
+
+func getJson(url string, v any) error {
+	resp, err := DoGet(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// getChecksum reads a checksum file in the sha256sum format
+func getChecksum(url string) (string, error) {
+	resp, err := DoGet(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	if scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			return fields[0], nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("empty checksum file")
+}
+
+// ExtractJava extracts a java archive to dest without the archive's top level directory, so the java binary
+// ends up where GetJavaPath expects it
+func ExtractJava(archive string, dest string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Entries that would land outside dest are skipped and the first one is returned as the error
+	var escapeErr error
+	var shift = func(path string) string {
+		// Apparently zips in windows can use / instead of \
+		// So we need to check if the path is using / or \
+		sep := filepath.Separator
+		if len(strings.Split(path, "\\")) > 1 {
+			sep = '\\'
+		} else if len(strings.Split(path, "/")) > 1 {
+			sep = '/'
+		}
+
+		parts := strings.Split(path, string(sep))
+		// macOS builds that nest the bundle (zulu-21.jre/Contents/Home) are flattened to Contents/Home
+		if i := slices.Index(parts, "Contents"); runtime.GOOS == "darwin" && i > 0 {
+			parts = parts[i:]
+		} else {
+			parts = parts[1:]
+		}
+		join := strings.Join(parts, string(sep))
+		if join == "" {
+			return ""
+		}
+		if _, err := SafeJoin(dest, join); err != nil {
+			if escapeErr == nil {
+				escapeErr = err
+			}
+			return ""
+		}
+		return join
+	}
+	if err = extract.Archive(context.TODO(), bufio.NewReader(f), dest, shift); err != nil {
+		return err
+	}
+	return escapeErr
+}
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJavaMajor(t *testing.T) {
+	tests := map[string]int{
+		"8":         8,
+		"1.8.0_392": 8,
+		"17.0.7+7":  17,
+		"21":        21,
+	}
+	for version, want := range tests {
+		got, err := javaMajor(version)
+		if err != nil {
+			t.Errorf("javaMajor(%s): %v", version, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("javaMajor(%s) = %d, want %d", version, got, want)
+		}
+	}
+}
+
+// useTestServer sends every request for prefix to a test server for the rest of the test
+func useTestServer(t *testing.T, prefix string, handler http.HandlerFunc) {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	opts := DefaultHTTPOptions
+	opts.Mirrors = map[string]string{prefix: srv.URL}
+	if err := SetHTTPOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = SetHTTPOptions(DefaultHTTPOptions)
+	})
+}
+
+func TestZuluGetJava(t *testing.T) {
+	useTestServer(t, zuluApiUrl, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			if r.URL.Query().Get("java_version") != "8" || r.URL.Query().Get("os") != "macos" || r.URL.Query().Get("arch") != "aarch64" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			_, _ = fmt.Fprint(w, `[{"package_uuid":"abc","name":"zulu8-jre.tar.gz","download_url":"https://cdn.azul.com/zulu8-jre.tar.gz"}]`)
+		case "/abc":
+			_, _ = fmt.Fprint(w, `{"package_uuid":"abc","name":"zulu8-jre.tar.gz","download_url":"https://cdn.azul.com/zulu8-jre.tar.gz","sha256_hash":"ABCDEF","size":42}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	file, err := Zulu{}.GetJava("1.8.0_392", "darwin", "arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Name != "jre.tar.gz" || file.Url != "https://cdn.azul.com/zulu8-jre.tar.gz" || file.Hash != "abcdef" || file.HashType != "sha256" || file.Size != 42 {
+		t.Errorf("unexpected file %+v", file)
+	}
+}
+
+func TestMicrosoftGetJava(t *testing.T) {
+	useTestServer(t, microsoftJdkUrl, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/microsoft-jdk-21-windows-x64.zip.sha256sum.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprint(w, "0123abcd  microsoft-jdk-21.0.1-windows-x64.zip\n")
+	})
+
+	file, err := Microsoft{}.GetJava("21", "windows", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Name != "jre.zip" || file.Url != microsoftJdkUrl+"/microsoft-jdk-21-windows-x64.zip" || file.Hash != "0123abcd" {
+		t.Errorf("unexpected file %+v", file)
+	}
+
+	// Only the LTS versions are published
+	if _, err = (Microsoft{}).GetJava("20", "windows", "amd64"); err == nil {
+		t.Error("expected an error for a version microsoft doesn't publish")
+	}
+}
@@ -0,0 +1,147 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// JavaRuntime is a java installation found by ProbeJava
+type JavaRuntime struct {
+	Path    string
+	Version string
+	Major   int
+	Vendor  string
+	Arch    string
+}
+
+// javaArchs are the os.arch values java reports for each GOARCH
+var javaArchs = map[string][]string{
+	"amd64": {"amd64", "x86_64"},
+	"386":   {"x86", "i386", "i486", "i586", "i686"},
+	"arm64": {"aarch64", "arm64"},
+	"arm":   {"arm", "aarch32"},
+}
+
+// ProbeJava runs the java at path to read its version, vendor and architecture
+func ProbeJava(path string) (JavaRuntime, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The properties are printed to stderr, -version keeps java from complaining there's nothing to run
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "-XshowSettings:properties", "-version")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return JavaRuntime{}, fmt.Errorf("unable to run %s: %s", path, err.Error())
+	}
+
+	props := parseJavaProperties(out.String())
+	runtimeInfo := JavaRuntime{
+		Path:    path,
+		Version: props["java.version"],
+		Vendor:  props["java.vendor"],
+		Arch:    props["os.arch"],
+	}
+	if runtimeInfo.Version == "" {
+		return JavaRuntime{}, fmt.Errorf("%s didn't report a java version", path)
+	}
+	major, err := javaMajor(runtimeInfo.Version)
+	if err != nil {
+		return JavaRuntime{}, err
+	}
+	runtimeInfo.Major = major
+	return runtimeInfo, nil
+}
+
+// parseJavaProperties reads the "key = value" lines printed by -XshowSettings:properties, multi value
+// properties like java.library.path only keep their first value
+func parseJavaProperties(output string) map[string]string {
+	props := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " = ")
+		if !ok {
+			continue
+		}
+		props[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return props
+}
+
+// Compatible reports if the runtime can run a pack that targets version, the reason is set when it can't
+func (j JavaRuntime) Compatible(version string) (bool, string) {
+	want, err := javaMajor(version)
+	if err != nil {
+		return false, err.Error()
+	}
+	if j.Major != want {
+		return false, fmt.Sprintf("java %d is needed but it's java %d", want, j.Major)
+	}
+	if archs, ok := javaArchs[runtime.GOARCH]; ok && !containsFold(archs, j.Arch) {
+		return false, fmt.Sprintf("it's built for %s, not %s", j.Arch, runtime.GOARCH)
+	}
+	return true, ""
+}
+
+// FindJava looks for a java already on the machine that's compatible with version, JAVA_HOME is checked before
+// the PATH. Every java found and why it was or wasn't picked is logged.
+func FindJava(version string) (JavaRuntime, bool) {
+	var candidates []string
+	if javaHome := os.Getenv("JAVA_HOME"); javaHome != "" {
+		name := "java"
+		if runtime.GOOS == "windows" {
+			name = "java.exe"
+		}
+		candidates = append(candidates, filepath.Join(javaHome, "bin", name))
+	}
+	if path, err := exec.LookPath("java"); err == nil {
+		candidates = append(candidates, path)
+	}
+
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		if resolved, err := filepath.EvalSymlinks(candidate); err == nil {
+			candidate = resolved
+		}
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+
+		found, err := ProbeJava(candidate)
+		if err != nil {
+			pterm.Debug.Printfln("Not using java at %s: %s", candidate, err.Error())
+			continue
+		}
+		if ok, reason := found.Compatible(version); !ok {
+			pterm.Info.Printfln("Not using java %s (%s) at %s, %s", found.Version, found.Vendor, found.Path, reason)
+			continue
+		}
+		pterm.Info.Printfln("Using java %s (%s, %s) at %s", found.Version, found.Vendor, found.Arch, found.Path)
+		return found, true
+	}
+	if len(candidates) == 0 {
+		pterm.Debug.Println("No java found in JAVA_HOME or on the PATH")
+	}
+	return JavaRuntime{}, false
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeJava writes a bin/java script into dir that prints properties the way -XshowSettings:properties does
+func fakeJava(t *testing.T, dir string, version string, arch string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake java is a shell script")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "bin", "java")
+	// Only shell builtins, the PATH is emptied to hide any real java
+	script := "#!/bin/sh\necho 'Property settings:' >&2\necho '    java.library.path = /usr/lib' >&2\necho '        /lib' >&2\n" +
+		"echo '    java.vendor = Eclipse Adoptium' >&2\necho '    java.version = " + version + "' >&2\n" +
+		"echo '    os.arch = " + arch + "' >&2\necho 'openjdk version \"" + version + "\"' >&2\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProbeJava(t *testing.T) {
+	java, err := ProbeJava(fakeJava(t, t.TempDir(), "1.8.0_392", "amd64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if java.Major != 8 || java.Version != "1.8.0_392" || java.Vendor != "Eclipse Adoptium" || java.Arch != "amd64" {
+		t.Errorf("unexpected runtime %+v", java)
+	}
+}
+
+func TestJavaCompatible(t *testing.T) {
+	hostArch := javaArchs[runtime.GOARCH][0]
+	tests := []struct {
+		name    string
+		runtime JavaRuntime
+		target  string
+		want    bool
+	}{
+		{"same major", JavaRuntime{Major: 21, Arch: hostArch}, "21.0.3+9", true},
+		{"older major", JavaRuntime{Major: 8, Arch: hostArch}, "21", false},
+		{"newer major", JavaRuntime{Major: 21, Arch: hostArch}, "17", false},
+		{"other arch", JavaRuntime{Major: 17, Arch: "ppc64le"}, "17", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := tt.runtime.Compatible(tt.target)
+			if got != tt.want {
+				t.Errorf("Compatible(%s) = %t (%s), want %t", tt.target, got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindJavaHome(t *testing.T) {
+	javaHome := t.TempDir()
+	fakeJava(t, javaHome, "17.0.9", javaArchs[runtime.GOARCH][0])
+	t.Setenv("JAVA_HOME", javaHome)
+	t.Setenv("PATH", "")
+
+	if java, ok := FindJava("17"); !ok || java.Major != 17 {
+		t.Errorf("expected java 17 from JAVA_HOME, got %+v", java)
+	}
+	if _, ok := FindJava("21"); ok {
+		t.Error("java 17 was used for a java 21 pack")
+	}
+}
@@ -0,0 +1,272 @@
+package util
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// What an update does with pack files that were edited after they were installed
+const (
+	LocalEditsOverwrite = "overwrite" // Replace them, the edited copy is only kept in the backup
+	LocalEditsKeep      = "keep"      // Leave them alone, the new version is written next to them as <file>.new
+	LocalEditsMerge     = "merge"     // Merge the update into them, keeping them and writing .new and .orig if it conflicts
+)
+
+// LocalEditPolicies are the values accepted by -local-edits
+var LocalEditPolicies = []string{LocalEditsOverwrite, LocalEditsKeep, LocalEditsMerge}
+
+const (
+	// OriginalsDirName keeps a copy of every text override file as it was installed, named by its hash. Overrides
+	// can't be downloaded again, so these are what local edits to them are merged against.
+	OriginalsDirName = ".ftb-originals"
+
+	mergeBaseDirName = ".merge-base"
+	newSuffix        = ".new"
+	origSuffix       = ".orig"
+	// maxOriginalSize leaves out anything bigger than a config file
+	maxOriginalSize = 1024 * 1024
+)
+
+// LocallyEdited returns the files from the installed manifest that no longer match the hash they were installed
+// with. Files that are missing aren't edits, the update just puts them back.
+func LocallyEdited(installDir string, files []structs.File) ([]structs.File, error) {
+	var edited []structs.File
+	for _, f := range files {
+		if f.Hash == "" {
+			continue
+		}
+		path, err := SafeJoin(installDir, f.Path, f.Name)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := FileHash(path, f.HashType)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to hash %s: %s", filePath(f), err.Error())
+		}
+		if !strings.EqualFold(hash, f.Hash) {
+			edited = append(edited, f)
+		}
+	}
+	return edited, nil
+}
+
+// SaveOriginals keeps a copy of the text files among files, as found in dir, for later updates to merge local
+// edits against. Only overrides are kept, every other file can be downloaded again.
+func SaveOriginals(installDir string, dir string, files []structs.File) error {
+	for _, f := range files {
+		if !f.Override || f.Size > maxOriginalSize {
+			continue
+		}
+		dst, ok := originalPath(installDir, f)
+		if !ok {
+			continue
+		}
+		if exists, _ := PathExists(dst); exists {
+			continue
+		}
+		src, err := SafeJoin(dir, f.Path, f.Name)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if !IsText(b) {
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err = os.WriteFile(dst, b, 0644); err != nil {
+			return fmt.Errorf("unable to keep the original %s: %s", filePath(f), err.Error())
+		}
+	}
+	return nil
+}
+
+// PruneOriginals removes the originals that none of the files in keep were installed as
+func PruneOriginals(installDir string, keep ...[]structs.File) error {
+	used := map[string]bool{}
+	for _, files := range keep {
+		for _, f := range files {
+			if p, ok := originalPath(installDir, f); ok {
+				used[p] = true
+			}
+		}
+	}
+	dir := filepath.Join(installDir, OriginalsDirName)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if !used[p] {
+			if err = os.RemoveAll(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// originalPath returns where the original of f is kept, the hash comes from a manifest so it's checked before
+// it's used as a file name
+func originalPath(installDir string, f structs.File) (string, bool) {
+	if !f.Override || f.Hash == "" {
+		return "", false
+	}
+	if _, err := hex.DecodeString(f.Hash); err != nil {
+		return "", false
+	}
+	return filepath.Join(installDir, OriginalsDirName, strings.ToLower(f.Hash)), true
+}
+
+// MergeBaseDir is where the installed versions of edited files are downloaded to so they can be merged
+func (t *UpdateTransaction) MergeBaseDir() string {
+	return filepath.Join(t.StagingDir, mergeBaseDirName)
+}
+
+// ResolveLocalEdits applies policy to the edited files before the update is committed. edited are the files from
+// the installed manifest, staged and replaced are what would be passed to Commit, the lists to commit instead
+// are returned. Side files are staged like any other file so a rollback removes them.
+func (t *UpdateTransaction) ResolveLocalEdits(policy string, edited, staged, replaced []structs.File) ([]structs.File, []structs.File, LocalEditsEvent, error) {
+	report := LocalEditsEvent{
+		Policy:      policy,
+		Overwritten: []string{},
+		Kept:        []string{},
+		Merged:      []string{},
+		Conflicts:   []string{},
+	}
+	staged, replaced = slices.Clone(staged), slices.Clone(replaced)
+	for _, f := range edited {
+		name := filePath(f)
+		if policy == LocalEditsOverwrite {
+			report.Overwritten = append(report.Overwritten, name)
+			continue
+		}
+
+		index := slices.IndexFunc(staged, func(s structs.File) bool { return s.Path == f.Path && s.Name == f.Name })
+		if index == -1 {
+			continue
+		}
+		stagedPath, err := SafeJoin(t.StagingDir, f.Path, f.Name)
+		if err != nil {
+			return nil, nil, report, err
+		}
+
+		if policy == LocalEditsMerge {
+			merged, err := t.merge(f, stagedPath)
+			if err != nil {
+				return nil, nil, report, err
+			}
+			if merged {
+				// The merged file replaces the edited one, which goes into the backup like any other update
+				report.Merged = append(report.Merged, name)
+				continue
+			}
+		}
+
+		// The edited file stays, so it's no longer replaced and the new version is staged beside it instead
+		if err = os.Rename(stagedPath, stagedPath+newSuffix); err != nil {
+			return nil, nil, report, fmt.Errorf("unable to stage %s%s: %s", name, newSuffix, err.Error())
+		}
+		staged[index] = structs.File{Path: f.Path, Name: f.Name + newSuffix}
+		replaced = slices.DeleteFunc(replaced, func(r structs.File) bool { return r.Path == f.Path && r.Name == f.Name })
+
+		if policy == LocalEditsKeep {
+			report.Kept = append(report.Kept, name)
+			continue
+		}
+		// The original makes it possible to see what changed on each side when merging by hand
+		basePath, err := t.basePath(f)
+		if err != nil {
+			return nil, nil, report, err
+		}
+		if basePath != "" {
+			if err = CopyFile(basePath, stagedPath+origSuffix); err != nil {
+				return nil, nil, report, fmt.Errorf("unable to stage %s%s: %s", name, origSuffix, err.Error())
+			}
+			staged = append(staged, structs.File{Path: f.Path, Name: f.Name + origSuffix})
+		}
+		report.Conflicts = append(report.Conflicts, name)
+	}
+	return staged, replaced, report, nil
+}
+
+// merge three way merges the staged version of f into the edited one, writing the result over the staged file.
+// It returns false if the files can't be merged, because they conflict, aren't text or the base is missing.
+func (t *UpdateTransaction) merge(f structs.File, stagedPath string) (bool, error) {
+	basePath, err := t.basePath(f)
+	if err != nil {
+		return false, err
+	}
+	localPath, err := SafeJoin(t.InstallDir, f.Path, f.Name)
+	if err != nil {
+		return false, err
+	}
+
+	// The base is downloaded separately and may have failed, without it there's nothing to merge against
+	if hash, err := FileHash(basePath, f.HashType); basePath == "" || err != nil || !strings.EqualFold(hash, f.Hash) {
+		pterm.Debug.Printfln("No original version of %s to merge with", filePath(f))
+		return false, nil
+	}
+	base, err := os.ReadFile(basePath)
+	if err != nil {
+		return false, err
+	}
+	local, err := os.ReadFile(localPath)
+	if err != nil {
+		return false, err
+	}
+	other, err := os.ReadFile(stagedPath)
+	if err != nil {
+		return false, err
+	}
+	if !IsText(base) || !IsText(local) || !IsText(other) {
+		return false, nil
+	}
+
+	merged, ok := Merge3(base, local, other)
+	if !ok {
+		return false, nil
+	}
+	if err = os.WriteFile(stagedPath, merged, 0644); err != nil {
+		return false, fmt.Errorf("unable to write merged %s: %s", filePath(f), err.Error())
+	}
+	return true, nil
+}
+
+// basePath returns the version of f that was installed, downloaded into MergeBaseDir or for overrides kept in
+// OriginalsDirName, or "" if there isn't one
+func (t *UpdateTransaction) basePath(f structs.File) (string, error) {
+	p, err := SafeJoin(t.MergeBaseDir(), f.Path, f.Name)
+	if err != nil {
+		return "", err
+	}
+	if exists, _ := PathExists(p); exists {
+		return p, nil
+	}
+	if p, ok := originalPath(t.InstallDir, f); ok {
+		if exists, _ := PathExists(p); exists {
+			return p, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,170 @@
+package util
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestResolveLocalEdits(t *testing.T) {
+	const (
+		base      = "a = 1\nb = 2\nc = 3\n"
+		update    = "a = 1\nb = 2\nc = 30\n"
+		mergeable = "a = 10\nb = 2\nc = 3\n"
+		conflict  = "a = 1\nb = 2\nc = 300\n"
+	)
+	write := func(dir, name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	installed := func(name string) structs.File {
+		return structs.File{Path: "config", Name: name, Hash: fmt.Sprintf("%x", sha1.Sum([]byte(base))), HashType: "sha1"}
+	}
+
+	tests := []struct {
+		policy string
+		want   map[string]string
+		report LocalEditsEvent
+	}{
+		{
+			policy: LocalEditsOverwrite,
+			want:   map[string]string{"merge.toml": update, "conflict.toml": update, "untouched.toml": update},
+			report: LocalEditsEvent{Overwritten: []string{"config/merge.toml", "config/conflict.toml"}},
+		},
+		{
+			policy: LocalEditsKeep,
+			want: map[string]string{
+				"merge.toml": mergeable, "merge.toml.new": update,
+				"conflict.toml": conflict, "conflict.toml.new": update,
+				"untouched.toml": update,
+			},
+			report: LocalEditsEvent{Kept: []string{"config/merge.toml", "config/conflict.toml"}},
+		},
+		{
+			policy: LocalEditsMerge,
+			want: map[string]string{
+				"merge.toml":    "a = 10\nb = 2\nc = 30\n",
+				"conflict.toml": conflict, "conflict.toml.new": update, "conflict.toml.orig": base,
+				"untouched.toml": update,
+			},
+			report: LocalEditsEvent{Merged: []string{"config/merge.toml"}, Conflicts: []string{"config/conflict.toml"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			installDir := t.TempDir()
+			write(installDir, "config/merge.toml", mergeable)
+			write(installDir, "config/conflict.toml", conflict)
+			write(installDir, "config/untouched.toml", base)
+
+			files := []structs.File{installed("merge.toml"), installed("conflict.toml"), installed("untouched.toml")}
+			edited, err := LocallyEdited(installDir, files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(edited) != 2 {
+				t.Fatalf("LocallyEdited found %d files, want 2", len(edited))
+			}
+
+			tx, err := NewUpdateTransaction(installDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var staged []structs.File
+			for _, f := range files {
+				write(tx.StagingDir, filepath.Join(f.Path, f.Name), update)
+				write(tx.MergeBaseDir(), filepath.Join(f.Path, f.Name), base)
+				staged = append(staged, structs.File{Path: f.Path, Name: f.Name})
+			}
+
+			staged, replaced, report, err := tx.ResolveLocalEdits(tt.policy, edited, staged, files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(report.Overwritten, tt.report.Overwritten) || !slices.Equal(report.Kept, tt.report.Kept) ||
+				!slices.Equal(report.Merged, tt.report.Merged) || !slices.Equal(report.Conflicts, tt.report.Conflicts) {
+				t.Errorf("report %+v, want %+v", report, tt.report)
+			}
+
+			if err = tx.Commit(staged, replaced, structs.Manifest{}); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(filepath.Join(installDir, "config"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Errorf("config has %d files, want %d", len(entries), len(tt.want))
+			}
+			for name, want := range tt.want {
+				got, err := os.ReadFile(filepath.Join(installDir, "config", name))
+				if err != nil {
+					t.Errorf("%s: %s", name, err)
+				} else if string(got) != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveLocalEditsOverride(t *testing.T) {
+	installDir := t.TempDir()
+	base := []byte("a = 1\nb = 2\nc = 3\n")
+	f := structs.File{Path: "config", Name: "a.toml", Hash: fmt.Sprintf("%x", sha1.Sum(base)), HashType: "sha1", Size: int64(len(base)), Override: true}
+
+	// The original is kept when the override is installed, before anyone edits it
+	if err := os.MkdirAll(filepath.Join(installDir, "config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(installDir, "config", "a.toml"), base, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveOriginals(installDir, installDir, []structs.File{f}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(installDir, "config", "a.toml"), []byte("a = 10\nb = 2\nc = 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := NewUpdateTransaction(installDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Join(tx.StagingDir, "config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(tx.StagingDir, "config", "a.toml"), []byte("a = 1\nb = 2\nc = 30\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	staged := []structs.File{{Path: "config", Name: "a.toml", Override: true}}
+	staged, replaced, report, err := tx.ResolveLocalEdits(LocalEditsMerge, []structs.File{f}, staged, []structs.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Merged) != 1 {
+		t.Fatalf("override wasn't merged against its original: %+v", report)
+	}
+	if err = tx.Commit(staged, replaced, structs.Manifest{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(installDir, "config", "a.toml")); string(got) != "a = 10\nb = 2\nc = 30\n" {
+		t.Errorf("config/a.toml = %q after merge", got)
+	}
+
+	if err = PruneOriginals(installDir); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(installDir, OriginalsDirName)); len(entries) != 0 {
+		t.Errorf("unused originals weren't pruned: %v", entries)
+	}
+}
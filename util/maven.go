@@ -0,0 +1,39 @@
+package util
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// mavenChecksums are the checksum files a Maven repository can publish next to an artifact with the length of
+// their hex digest, the strongest one published is used
+var mavenChecksums = []struct {
+	hashType string
+	length   int
+}{
+	{"sha256", 64},
+	{"sha1", 40},
+	{"md5", 32},
+}
+
+// MavenChecksum gets the checksum published for the Maven artifact at artifactUrl, returning the hash and its
+// type. An artifact without a usable checksum is an error so it can't be downloaded unverified.
+func MavenChecksum(artifactUrl string) (string, string, error) {
+	for _, c := range mavenChecksums {
+		hash, err := getChecksum(artifactUrl + "." + c.hashType)
+		if err != nil {
+			pterm.Debug.Printfln("No %s checksum for %s: %s", c.hashType, artifactUrl, err.Error())
+			continue
+		}
+		hash = strings.ToLower(hash)
+		if _, err = hex.DecodeString(hash); err != nil || len(hash) != c.length {
+			pterm.Debug.Printfln("Invalid %s checksum %q for %s", c.hashType, hash, artifactUrl)
+			continue
+		}
+		return hash, c.hashType, nil
+	}
+	return "", "", fmt.Errorf("no checksum is published for %s, unable to verify it", artifactUrl)
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+const testMaven = "https://maven.example.com"
+
+func TestMavenChecksum(t *testing.T) {
+	useTestServer(t, testMaven, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sha1/installer.jar.sha1":
+			_, _ = fmt.Fprint(w, "DA39A3EE5E6B4B0D3255BFEF95601890AFD80709")
+		case "/sha256/installer.jar.sha256":
+			_, _ = fmt.Fprint(w, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  installer.jar\n")
+		case "/sha256/installer.jar.sha1":
+			t.Error("sha1 was fetched when a sha256 is published")
+		case "/md5/installer.jar.md5":
+			_, _ = fmt.Fprint(w, "d41d8cd98f00b204e9800998ecf8427e")
+		case "/invalid/installer.jar.sha1":
+			_, _ = fmt.Fprint(w, "<html>not found</html>")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	tests := []struct {
+		path     string
+		hash     string
+		hashType string
+	}{
+		{"/sha256/installer.jar", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", "sha256"},
+		{"/sha1/installer.jar", "da39a3ee5e6b4b0d3255bfef95601890afd80709", "sha1"},
+		{"/md5/installer.jar", "d41d8cd98f00b204e9800998ecf8427e", "md5"},
+		{"/invalid/installer.jar", "", ""},
+		{"/none/installer.jar", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			hash, hashType, err := MavenChecksum(testMaven + tt.path)
+			if tt.hash == "" {
+				if err == nil {
+					t.Errorf("expected an error, got %s %s", hashType, hash)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != tt.hash || hashType != tt.hashType {
+				t.Errorf("got %s %s, want %s %s", hashType, hash, tt.hashType, tt.hash)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package util
+
+import (
+	"bytes"
+	"slices"
+	"unicode/utf8"
+)
+
+// maxMergeCells caps the size of the diff table, files too big to diff are treated as a conflict
+const maxMergeCells = 16 * 1024 * 1024
+
+// IsText reports if b looks like a text file that can be merged line by line
+func IsText(b []byte) bool {
+	return utf8.Valid(b) && bytes.IndexByte(b, 0) == -1
+}
+
+// Merge3 merges the changes local and other made to base line by line, the same way diff3 does. A change made
+// on only one side is taken, the same change made on both sides is taken once. It returns false if both
+// changed the same lines differently, the merged content is only valid when it returns true.
+func Merge3(base, local, other []byte) ([]byte, bool) {
+	o, a, b := splitLines(base), splitLines(local), splitLines(other)
+	matchA, ok := matchLines(o, a)
+	if !ok {
+		return nil, false
+	}
+	matchB, ok := matchLines(o, b)
+	if !ok {
+		return nil, false
+	}
+
+	var merged [][]byte
+	i, j, k := 0, 0, 0
+	for i < len(o) || j < len(a) || k < len(b) {
+		// Lines none of the three changed are copied as they are
+		if i < len(o) && matchA[i] == j && matchB[i] == k {
+			merged = append(merged, o[i])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+
+		// Everything up to the next unchanged line was changed on at least one side
+		next := i
+		for next < len(o) && (matchA[next] < 0 || matchB[next] < 0) {
+			next++
+		}
+		nextA, nextB := len(a), len(b)
+		if next < len(o) {
+			nextA, nextB = matchA[next], matchB[next]
+		}
+		chunkO, chunkA, chunkB := o[i:next], a[j:nextA], b[k:nextB]
+
+		switch {
+		case equalLines(chunkO, chunkA):
+			merged = append(merged, chunkB...)
+		case equalLines(chunkO, chunkB), equalLines(chunkA, chunkB):
+			merged = append(merged, chunkA...)
+		default:
+			return nil, false
+		}
+		i, j, k = next, nextA, nextB
+	}
+	return bytes.Join(merged, nil), true
+}
+
+// splitLines splits b after every newline so joining the lines gives b back
+func splitLines(b []byte) [][]byte {
+	var lines [][]byte
+	for len(b) > 0 {
+		n := bytes.IndexByte(b, '\n') + 1
+		if n == 0 {
+			n = len(b)
+		}
+		lines = append(lines, b[:n])
+		b = b[n:]
+	}
+	return lines
+}
+
+// matchLines pairs the lines of base with the lines of changed using the longest common subsequence, match[i]
+// is the line of changed that base line i is kept as, or -1 if it was changed or removed
+func matchLines(base, changed [][]byte) ([]int, bool) {
+	n, m := len(base), len(changed)
+	if (n+1)*(m+1) > maxMergeCells {
+		return nil, false
+	}
+	// lcs[i][j] is the length of the longest common subsequence of base[i:] and changed[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if bytes.Equal(base[i], changed[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	match := make([]int, n)
+	for i := range match {
+		match[i] = -1
+	}
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case bytes.Equal(base[i], changed[j]):
+			match[i] = j
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return match, true
+}
+
+func equalLines(a, b [][]byte) bool {
+	return slices.EqualFunc(a, b, bytes.Equal)
+}
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	base := "a = 1\nb = 2\nc = 3\nd = 4\n"
+	tests := []struct {
+		name  string
+		local string
+		other string
+		want  string
+		ok    bool
+	}{
+		{"only local changed", "a = 1\nb = 20\nc = 3\nd = 4\n", base, "a = 1\nb = 20\nc = 3\nd = 4\n", true},
+		{"only other changed", base, "a = 1\nb = 2\nc = 3\nd = 40\n", "a = 1\nb = 2\nc = 3\nd = 40\n", true},
+		{"different lines", "a = 10\nb = 2\nc = 3\nd = 4\n", "a = 1\nb = 2\nc = 3\nd = 4\ne = 5\n", "a = 10\nb = 2\nc = 3\nd = 4\ne = 5\n", true},
+		{"same change", "a = 1\nb = 5\nc = 3\nd = 4\n", "a = 1\nb = 5\nc = 3\nd = 4\n", "a = 1\nb = 5\nc = 3\nd = 4\n", true},
+		{"removed and added", "a = 1\nc = 3\nd = 4\n", "# header\na = 1\nb = 2\nc = 3\nd = 4\n", "# header\na = 1\nc = 3\nd = 4\n", true},
+		{"no trailing newline", "a = 1\nb = 2\nc = 3\nd = 4", "a = 0\nb = 2\nc = 3\nd = 4\n", "a = 0\nb = 2\nc = 3\nd = 4", true},
+		{"conflict", "a = 1\nb = 20\nc = 3\nd = 4\n", "a = 1\nb = 200\nc = 3\nd = 4\n", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Merge3([]byte(base), []byte(tt.local), []byte(tt.other))
+			if ok != tt.ok {
+				t.Fatalf("Merge3 ok = %t, want %t", ok, tt.ok)
+			}
+			if ok && string(got) != tt.want {
+				t.Errorf("Merge3 = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsText(t *testing.T) {
+	if !IsText([]byte("key = \"välue\"\r\n")) {
+		t.Error("utf-8 config wasn't text")
+	}
+	if IsText([]byte{'P', 'K', 3, 4, 0, 0}) {
+		t.Error("zip was text")
+	}
+}
@@ -0,0 +1,228 @@
+package util
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// OpenPackFS opens a modpack zip/mrpack archive or an extracted modpack directory as a fs.FS.
+// The returned close function must be called once the fs is no longer needed.
+func OpenPackFS(source string) (fs.FS, func() error, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return os.DirFS(source), func() error { return nil }, nil
+	}
+
+	zipReader, err := zip.OpenReader(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open %s as a zip archive: %s", source, err.Error())
+	}
+	return zipReader, zipReader.Close, nil
+}
+
+// OverrideFiles lists the files in the override folders of a modpack so they can be tracked in the manifest like
+// the files that are downloaded, a file in a later folder replaces the same file from an earlier one
+func OverrideFiles(overrides structs.Overrides) ([]structs.File, error) {
+	if overrides.Source == "" {
+		return nil, nil
+	}
+	packFS, closeFS, err := OpenPackFS(overrides.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFS()
+
+	var files []structs.File
+	index := map[string]int{}
+	for _, dir := range overrides.Dirs {
+		if _, err := fs.Stat(packFS, dir); errors.Is(err, fs.ErrNotExist) {
+			pterm.Debug.Printfln("Overrides folder %s not found in %s", dir, overrides.Source)
+			continue
+		}
+		err = fs.WalkDir(packFS, dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			relPath := p
+			if dir != "." {
+				relPath = strings.TrimPrefix(p, dir+"/")
+			}
+			hash, size, err := hashFSFile(packFS, p)
+			if err != nil {
+				return err
+			}
+			dirPath := path.Dir(relPath)
+			if dirPath == "." {
+				dirPath = ""
+			}
+			f := structs.File{
+				Name:     path.Base(relPath),
+				Path:     dirPath,
+				Hash:     hash,
+				HashType: "sha1",
+				Size:     size,
+				Override: true,
+			}
+			if i, ok := index[relPath]; ok {
+				files[i] = f
+				return nil
+			}
+			index[relPath] = len(files)
+			files = append(files, f)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", dir, err.Error())
+		}
+	}
+	return files, nil
+}
+
+// MergeOverrides adds the override files to the pack files, an override replaces a pack file at the same path
+func MergeOverrides(files []structs.File, overrides []structs.File) []structs.File {
+	overridden := map[string]bool{}
+	for _, f := range overrides {
+		overridden[filePath(f)] = true
+	}
+	var merged []structs.File
+	for _, f := range files {
+		if !overridden[filePath(f)] {
+			merged = append(merged, f)
+		}
+	}
+	return append(merged, overrides...)
+}
+
+// SplitOverrides separates the files that are downloaded from the ones copied from the overrides
+func SplitOverrides(files []structs.File) (downloads []structs.File, overrides []structs.File) {
+	for _, f := range files {
+		if f.Override {
+			overrides = append(overrides, f)
+		} else {
+			downloads = append(downloads, f)
+		}
+	}
+	return downloads, overrides
+}
+
+// CopyOverrides copies the given override files, as listed by OverrideFiles, from the modpack into dst
+func CopyOverrides(overrides structs.Overrides, files []structs.File, dst string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	packFS, closeFS, err := OpenPackFS(overrides.Source)
+	if err != nil {
+		return err
+	}
+	defer closeFS()
+
+	for _, f := range files {
+		// Later folders take priority, so the file comes from the last folder that has it
+		src := ""
+		for i := len(overrides.Dirs) - 1; i >= 0 && src == ""; i-- {
+			p := path.Join(overrides.Dirs[i], filePath(f))
+			if _, err := fs.Stat(packFS, p); err == nil {
+				src = p
+			}
+		}
+		if src == "" {
+			return fmt.Errorf("%s is missing from the overrides", filePath(f))
+		}
+		dstPath, err := SafeJoin(dst, f.Path, f.Name)
+		if err != nil {
+			return err
+		}
+		if err = copyFSFile(packFS, src, dstPath); err != nil {
+			return fmt.Errorf("unable to copy %s: %s", filePath(f), err.Error())
+		}
+	}
+	return nil
+}
+
+// CopyFS copies everything under root in fsys to dst, existing files are replaced rather than written over
+func CopyFS(fsys fs.FS, root string, dst string) error {
+	return fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath := p
+		if p == root {
+			relPath = "."
+		} else if root != "." {
+			relPath = strings.TrimPrefix(p, root+"/")
+		}
+		dstPath, err := SafeJoin(dst, filepath.FromSlash(relPath))
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return os.MkdirAll(dstPath, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFSFile(fsys, p, dstPath)
+	})
+}
+
+// copyFSFile copies name from fsys to dstPath through a temp file, the existing file may be hardlinked to the
+// download cache and writing into it would change every copy
+func copyFSFile(fsys fs.FS, name string, dstPath string) error {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dstPath), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dstPath)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func hashFSFile(fsys fs.FS, name string) (string, int64, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha1.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), size, nil
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"ftb-server-downloader/structs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCopyFSKeepsHardlinks(t *testing.T) {
+	dir := t.TempDir()
+	cached := filepath.Join(dir, "cache.jar")
+	if err := os.WriteFile(cached, []byte("cached"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	installDir := filepath.Join(dir, "server")
+	if err := os.MkdirAll(filepath.Join(installDir, "mods"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(cached, filepath.Join(installDir, "mods", "x.jar")); err != nil {
+		t.Skip("hardlinks not supported:", err)
+	}
+
+	overrides := fstest.MapFS{"overrides/mods/x.jar": {Data: []byte("override")}}
+	if err := CopyFS(overrides, "overrides", installDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(installDir, "mods", "x.jar")); string(got) != "override" {
+		t.Errorf("mods/x.jar = %q, want %q", got, "override")
+	}
+	if got, _ := os.ReadFile(cached); string(got) != "cached" {
+		t.Errorf("hardlinked cache entry was changed to %q", got)
+	}
+}
+
+func TestOverrideFiles(t *testing.T) {
+	source := t.TempDir()
+	for name, content := range map[string]string{
+		"overrides/config/a.toml":        "a = 1\n",
+		"overrides/mods/pack.jar":        "override jar",
+		"server-overrides/config/a.toml": "a = 2\n",
+		"server-overrides/server.txt":    "server",
+	} {
+		path := filepath.Join(source, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	overrides := structs.Overrides{Source: source, Dirs: []string{"overrides", "server-overrides"}}
+
+	files, err := OverrideFiles(overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packFiles := []structs.File{{Path: "mods", Name: "pack.jar", Url: "https://cdn/pack.jar"}, {Path: "mods", Name: "other.jar", Url: "https://cdn/other.jar"}}
+	merged := MergeOverrides(packFiles, files)
+	downloads, copied := SplitOverrides(merged)
+	if len(downloads) != 1 || downloads[0].Name != "other.jar" {
+		t.Errorf("got downloads %+v, want only mods/other.jar", downloads)
+	}
+	if len(copied) != 3 {
+		t.Fatalf("got %d override files, want 3: %+v", len(copied), copied)
+	}
+
+	installDir := t.TempDir()
+	if err = CopyOverrides(overrides, copied, installDir); err != nil {
+		t.Fatal(err)
+	}
+	report, err := VerifyInstall(installDir, structs.Manifest{Files: copied})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.HasDrift() {
+		t.Errorf("copied overrides don't match their hashes: %+v", report)
+	}
+	if got, _ := os.ReadFile(filepath.Join(installDir, "config", "a.toml")); string(got) != "a = 2\n" {
+		t.Errorf("config/a.toml = %q, want server-overrides to win", got)
+	}
+}
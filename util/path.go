@@ -0,0 +1,82 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PathEscapeError is returned by SafeJoin when a path from a manifest, API response or archive would end up
+// outside the directory it's meant to be in
+type PathEscapeError struct {
+	Root   string
+	Path   string
+	Reason string
+}
+
+func (e *PathEscapeError) Error() string {
+	return fmt.Sprintf("refusing to use %s, %s (outside of %s)", e.Path, e.Reason, e.Root)
+}
+
+// SafeJoin joins elem onto root like filepath.Join, but only if the result stays inside root. Absolute paths,
+// .. segments and symlinks under root that point out of it are rejected with a *PathEscapeError.
+func SafeJoin(root string, elem ...string) (string, error) {
+	rel := filepath.Join(elem...)
+	escapeErr := func(reason string) error {
+		return &PathEscapeError{Root: root, Path: filepath.ToSlash(rel), Reason: reason}
+	}
+
+	for _, e := range elem {
+		if filepath.IsAbs(e) || filepath.VolumeName(e) != "" || strings.HasPrefix(e, "/") || strings.HasPrefix(e, "\\") {
+			return "", escapeErr("it's an absolute path")
+		}
+		// Both separators are checked, paths from windows zips can use either
+		for _, part := range strings.FieldsFunc(e, func(r rune) bool { return r == '/' || r == '\\' }) {
+			if part == ".." {
+				return "", escapeErr("it contains ..")
+			}
+		}
+	}
+	if rel != "." && !filepath.IsLocal(rel) {
+		return "", escapeErr("it isn't a local path")
+	}
+
+	// Anything that already exists on the way may be a symlink leading somewhere else
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return filepath.Join(root, rel), nil
+		}
+		return "", err
+	}
+	current := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		target, err := filepath.EvalSymlinks(current)
+		if err != nil {
+			return "", escapeErr("it goes through a broken symlink")
+		}
+		if !isWithin(realRoot, target) {
+			return "", escapeErr("it goes through a symlink to " + target)
+		}
+	}
+	return filepath.Join(root, rel), nil
+}
+
+func isWithin(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
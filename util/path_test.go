@@ -0,0 +1,66 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "mods"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(root, "mods"), filepath.Join(root, "inside")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		elem    []string
+		safe    bool
+		symlink bool
+	}{
+		{"file", []string{"mods", "mod.jar"}, true, false},
+		{"root file", []string{"", "server.jar"}, true, false},
+		{"new directory", []string{"config/new", "settings.toml"}, true, false},
+		{"parent", []string{"..", "mod.jar"}, false, false},
+		{"parent in path", []string{"mods/../../etc", "passwd"}, false, false},
+		{"parent in name", []string{"mods", "../../mod.jar"}, false, false},
+		{"backslash parent", []string{"mods\\..\\..", "mod.jar"}, false, false},
+		{"absolute", []string{"/etc", "passwd"}, false, false},
+		{"absolute backslash", []string{"\\etc", "passwd"}, false, false},
+		{"symlink out", []string{"escape", "mod.jar"}, false, true},
+		{"symlink in", []string{"inside", "mod.jar"}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.symlink && runtime.GOOS == "windows" {
+				t.Skip("symlinks need extra privileges on windows")
+			}
+			path, err := SafeJoin(root, tt.elem...)
+			if tt.safe {
+				if err != nil {
+					t.Fatalf("SafeJoin(%q) = %v", tt.elem, err)
+				}
+				if want := filepath.Join(append([]string{root}, tt.elem...)...); path != want {
+					t.Errorf("SafeJoin(%q) = %s, want %s", tt.elem, path, want)
+				}
+				return
+			}
+			var escapeErr *PathEscapeError
+			if !errors.As(err, &escapeErr) {
+				t.Fatalf("SafeJoin(%q) = %s, %v, want a PathEscapeError", tt.elem, path, err)
+			}
+		})
+	}
+}
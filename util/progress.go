@@ -0,0 +1,116 @@
+package util
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// speedSmoothing is how much weight the latest sample gets in the moving average used for the speed
+const speedSmoothing = 0.3
+
+// Progress tracks the bytes downloaded across a batch of files so the total, throughput and ETA can
+// be shown while downloading
+type Progress struct {
+	total      atomic.Int64
+	done       atomic.Int64
+	mu         sync.Mutex
+	lastDone   int64
+	lastSample time.Time
+	speed      float64
+}
+
+func NewProgress(total int64) *Progress {
+	p := &Progress{lastSample: time.Now()}
+	p.total.Store(total)
+	return p
+}
+
+// Tracker returns a ProgressFunc for a single file. size is the expected size of the file, if it's 0 the
+// size reported by the server is added to the total instead. Retries of the same file must reuse the
+// tracker so bytes from an attempt that restarted aren't counted twice.
+func (p *Progress) Tracker(size int64) ProgressFunc {
+	var last int64
+	var mu sync.Mutex
+	sized := size > 0
+	return func(written, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !sized && total > 0 {
+			p.total.Add(total)
+			sized = true
+		}
+		p.done.Add(written - last)
+		last = written
+	}
+}
+
+func (p *Progress) Total() int64 {
+	return p.total.Load()
+}
+
+func (p *Progress) Done() int64 {
+	return p.done.Load()
+}
+
+// Sample updates the current speed from the bytes downloaded since the last sample and returns it in bytes
+// per second, it should be called at a regular interval
+func (p *Progress) Sample() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(p.lastSample).Seconds()
+	if elapsed <= 0 {
+		return p.speed
+	}
+	done := p.done.Load()
+	current := float64(done-p.lastDone) / elapsed
+	if p.speed == 0 {
+		p.speed = current
+	} else {
+		p.speed = speedSmoothing*current + (1-speedSmoothing)*p.speed
+	}
+	p.lastDone = done
+	p.lastSample = now
+	return p.speed
+}
+
+// ETA returns how long the rest of the download should take at the last sampled speed, or -1 if it
+// can't be worked out yet
+func (p *Progress) ETA() time.Duration {
+	p.mu.Lock()
+	speed := p.speed
+	p.mu.Unlock()
+	remaining := p.Total() - p.Done()
+	if speed <= 0 || remaining < 0 {
+		return -1
+	}
+	return time.Duration(float64(remaining) / speed * float64(time.Second)).Round(time.Second)
+}
+
+// String formats the progress as "done / total | speed | ETA"
+func (p *Progress) String() string {
+	p.mu.Lock()
+	speed := p.speed
+	p.mu.Unlock()
+	eta := "unknown"
+	if d := p.ETA(); d >= 0 {
+		eta = d.String()
+	}
+	return fmt.Sprintf("%s / %s | %s/s | ETA %s", FormatBytes(p.Done()), FormatBytes(p.Total()), FormatBytes(int64(speed)), eta)
+}
+
+// FormatBytes formats a byte count as a human-readable size, e.g. 1.5 MiB
+func FormatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
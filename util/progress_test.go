@@ -0,0 +1,44 @@
+package util
+
+import "testing"
+
+func TestProgressTracker(t *testing.T) {
+	p := NewProgress(1000)
+
+	sized := p.Tracker(1000)
+	sized(0, 1000)
+	sized(400, 1000)
+	// A retry that restarts from scratch mustn't count the first attempt's bytes twice
+	sized(0, 1000)
+	sized(600, 1000)
+
+	unsized := p.Tracker(0)
+	unsized(0, 500)
+	unsized(500, 500)
+
+	if got := p.Done(); got != 1100 {
+		t.Errorf("Done() = %d, want 1100", got)
+	}
+	if got := p.Total(); got != 1500 {
+		t.Errorf("Total() = %d, want 1500", got)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	var tests = []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{300 * 1024 * 1024, "300.0 MiB"},
+		{5 * 1024 * 1024 * 1024, "5.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.bytes); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.bytes, got, tt.want)
+		}
+	}
+}
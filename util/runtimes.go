@@ -0,0 +1,179 @@
+package util
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// RuntimeStore is a directory of JREs shared between installs so every server on a host doesn't need its own
+// copy. Each runtime is extracted to <Dir>/<name> and every install using it leaves a reference in
+// <Dir>/.refs/<name>, GC removes the runtimes nothing references any more.
+type RuntimeStore struct {
+	Dir string
+}
+
+const runtimeRefsDir = ".refs"
+
+func NewRuntimeStore(dir string) (*RuntimeStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, runtimeRefsDir), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create runtime directory: %s", err.Error())
+	}
+	return &RuntimeStore{Dir: dir}, nil
+}
+
+// RuntimeName is the store entry for a java version from a provider, e.g. adoptium-21.0.3+9-amd64
+func RuntimeName(vendor string, version string, goarch string) string {
+	return fmt.Sprintf("%s-%s-%s", vendor, version, goarch)
+}
+
+// JavaPath is the absolute path to the java binary of runtime name
+func (s *RuntimeStore) JavaPath(name string) (string, error) {
+	return javaBinPath(filepath.Join(s.Dir, name))
+}
+
+// Has reports if runtime name is in the store
+func (s *RuntimeStore) Has(name string) (bool, error) {
+	path, err := s.JavaPath(name)
+	if err != nil {
+		return false, err
+	}
+	return PathExists(path)
+}
+
+// Add extracts the java archive into the store as runtime name. It's extracted to a temp directory first and
+// renamed into place, so an install running at the same time never sees half a runtime.
+func (s *RuntimeStore) Add(name string, archive string) error {
+	tmp, err := os.MkdirTemp(s.Dir, ".tmp-"+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	// Servers on the same host can run as different users
+	if err = os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	if err = ExtractJava(archive, tmp); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, filepath.Join(s.Dir, name)); err != nil {
+		// Another install added the same runtime first
+		if has, _ := s.Has(name); has {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// AddReference records that the server in installDir uses runtime name
+func (s *RuntimeStore) AddReference(name string, installDir string) error {
+	ref := s.referencePath(name, installDir)
+	if err := os.MkdirAll(filepath.Dir(ref), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(ref, []byte(installDir), 0644)
+}
+
+func (s *RuntimeStore) referencePath(name string, installDir string) string {
+	sum := sha1.Sum([]byte(installDir))
+	return filepath.Join(s.Dir, runtimeRefsDir, name, hex.EncodeToString(sum[:]))
+}
+
+// GC removes every runtime that no installed server uses, returning the names of the runtimes removed.
+// A reference only counts while the manifest in its install directory, or the one a rollback would restore,
+// still names the runtime, so servers that were deleted, uninstalled or updated to another java let go of it.
+func (s *RuntimeStore) GC() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || name == runtimeRefsDir {
+			continue
+		}
+		// Temp directories older than an hour belong to an install that died mid extract
+		if strings.HasPrefix(name, ".tmp-") {
+			if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > time.Hour {
+				_ = os.RemoveAll(filepath.Join(s.Dir, name))
+			}
+			continue
+		}
+
+		used, err := s.inUse(name)
+		if err != nil {
+			return removed, err
+		}
+		if used {
+			continue
+		}
+		pterm.Debug.Printfln("Removing unused runtime %s", name)
+		if err = os.RemoveAll(filepath.Join(s.Dir, name)); err != nil {
+			return removed, err
+		}
+		_ = os.RemoveAll(filepath.Join(s.Dir, runtimeRefsDir, name))
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// inUse checks the references to runtime name, dropping the ones that are stale
+func (s *RuntimeStore) inUse(name string) (bool, error) {
+	refsDir := filepath.Join(s.Dir, runtimeRefsDir, name)
+	refs, err := os.ReadDir(refsDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	used := false
+	for _, ref := range refs {
+		refPath := filepath.Join(refsDir, ref.Name())
+		info, err := ref.Info()
+		if err != nil {
+			return false, err
+		}
+		// The manifest is written at the end of an install, a fresh reference may belong to one still running
+		if time.Since(info.ModTime()) < time.Hour {
+			used = true
+			continue
+		}
+		installDir, err := os.ReadFile(refPath)
+		if err != nil {
+			return false, err
+		}
+
+		manifest, err := ReadManifest(string(installDir))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			// Better to keep the runtime than break a server we can't check
+			pterm.Warning.Printfln("Keeping runtime %s, unable to read the manifest in %s: %s", name, installDir, err.Error())
+			used = true
+			continue
+		}
+		if err == nil && manifest.Runtime == name {
+			used = true
+			continue
+		}
+		// A rollback puts back the runtime the server used before its last update
+		if backup, err := ReadManifest(filepath.Join(string(installDir), BackupDirName)); err == nil && backup.Runtime == name {
+			used = true
+			continue
+		}
+		pterm.Debug.Printfln("%s no longer uses runtime %s", installDir, name)
+		_ = os.Remove(refPath)
+	}
+	return used, nil
+}
@@ -0,0 +1,145 @@
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"ftb-server-downloader/structs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// javaArchive writes a tar.gz laid out like a JRE download, with everything under a top level directory
+func javaArchive(t *testing.T, path string) {
+	bin, err := javaBinPath("jdk-21.0.3+9-jre")
+	if err != nil {
+		t.Skip(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	content := []byte("#!/bin/sh\n")
+	if err = tw.WriteHeader(&tar.Header{Name: filepath.ToSlash(bin), Mode: 0755, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRuntimeStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewRuntimeStore(filepath.Join(dir, "runtimes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "jre.tar.gz")
+	javaArchive(t, archive)
+
+	name := RuntimeName("adoptium", "21.0.3+9", "amd64")
+	if err = store.Add(name, archive); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := store.Has(name); err != nil || !has {
+		t.Fatalf("runtime %s wasn't added: %v", name, err)
+	}
+	// A second install adding the same runtime keeps the first one
+	if err = store.Add(name, archive); err != nil {
+		t.Fatalf("adding an existing runtime: %v", err)
+	}
+
+	servers := []string{filepath.Join(dir, "server1"), filepath.Join(dir, "server2")}
+	for _, server := range servers {
+		if err = os.MkdirAll(server, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = WriteManifest(server, structs.Manifest{Name: "pack", Runtime: name}); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.AddReference(name, server); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-2 * time.Hour)
+		_ = os.Chtimes(store.referencePath(name, server), old, old)
+	}
+
+	// server2 moved to another java, server1 still uses the runtime
+	if err = WriteManifest(servers[1], structs.Manifest{Name: "pack", Runtime: "zulu-21-amd64"}); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := store.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("removed %v while server1 uses it", removed)
+	}
+	if exists, _ := PathExists(store.referencePath(name, servers[1])); exists {
+		t.Error("stale reference from server2 wasn't removed")
+	}
+
+	// Once server1 is deleted nothing uses the runtime
+	if err = os.RemoveAll(servers[0]); err != nil {
+		t.Fatal(err)
+	}
+	removed, err = store.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != name {
+		t.Fatalf("removed %v, want [%s]", removed, name)
+	}
+	if has, _ := store.Has(name); has {
+		t.Error("runtime is still in the store")
+	}
+}
+
+func TestRuntimeStoreKeepsRollbackRuntime(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewRuntimeStore(filepath.Join(dir, "runtimes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "jre.tar.gz")
+	javaArchive(t, archive)
+	name := RuntimeName("adoptium", "17.0.11+9", "amd64")
+	if err = store.Add(name, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server was updated to another java, but the backup of the previous version still uses the runtime
+	server := filepath.Join(dir, "server")
+	if err = os.MkdirAll(filepath.Join(server, BackupDirName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteManifest(server, structs.Manifest{Name: "pack", Runtime: "adoptium-21.0.3+9-amd64"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteManifest(filepath.Join(server, BackupDirName), structs.Manifest{Name: "pack", Runtime: name}); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.AddReference(name, server); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	_ = os.Chtimes(store.referencePath(name, server), old, old)
+
+	removed, err := store.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("removed %v while a rollback would use it", removed)
+	}
+}
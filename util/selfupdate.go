@@ -0,0 +1,102 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"aead.dev/minisign"
+	"github.com/minio/selfupdate"
+)
+
+// UpdatePublicKey is the minisign public key releases are signed with, it's set at build time with
+// -ldflags "-X 'ftb-server-downloader/util.UpdatePublicKey=<key>'"
+var UpdatePublicKey string
+
+// ApplyUpdate replaces target, or the running installer when target is empty, with the binary at binaryUrl.
+// The binary is only used if the minisign signature next to it (binaryUrl + ".minisig") was made with
+// UpdatePublicKey and its trusted comment is "<filename> <version>", so a signed binary for another release or
+// platform can't be served in its place. The signature is also handed to selfupdate, which checks it once more
+// before replacing the binary. Builds without a key can't update themselves.
+func ApplyUpdate(binaryUrl, filename, version, target string) error {
+	if UpdatePublicKey == "" {
+		return errors.New("this build has no update signing key, download the new version from the releases page")
+	}
+	var publicKey minisign.PublicKey
+	if err := publicKey.UnmarshalText([]byte(UpdatePublicKey)); err != nil {
+		return fmt.Errorf("invalid update signing key: %s", err.Error())
+	}
+
+	signature, err := getUpdateFile(binaryUrl + ".minisig")
+	if err != nil {
+		return fmt.Errorf("error downloading update signature: %s", err.Error())
+	}
+	binary, err := getUpdateFile(binaryUrl)
+	if err != nil {
+		return fmt.Errorf("error downloading update: %s", err.Error())
+	}
+
+	// Verify checks the trusted comment was signed too, it can only be read once that's known
+	if !minisign.Verify(publicKey, binary, signature) {
+		return errors.New("the update signature doesn't match, the update wasn't applied")
+	}
+	var sig minisign.Signature
+	if err = sig.UnmarshalText(signature); err != nil {
+		return fmt.Errorf("error reading update signature: %s", err.Error())
+	}
+	if want := filename + " " + version; sig.TrustedComment != want {
+		return fmt.Errorf("the update is signed as %q but %q was expected, the update wasn't applied", sig.TrustedComment, want)
+	}
+
+	// selfupdate checks the signature again before it swaps the binary in
+	verifier, err := updateVerifier(signature)
+	if err != nil {
+		return fmt.Errorf("error reading update signature: %s", err.Error())
+	}
+	err = selfupdate.Apply(bytes.NewReader(binary), selfupdate.Options{TargetPath: target, Verifier: verifier})
+	if err != nil {
+		if rollbackErr := selfupdate.RollbackError(err); rollbackErr != nil {
+			return fmt.Errorf("error applying update: %s, unable to restore the previous version: %s", err.Error(), rollbackErr.Error())
+		}
+		return fmt.Errorf("error applying update: %s", err.Error())
+	}
+	return nil
+}
+
+// updateVerifier loads the signature that was already downloaded into a selfupdate verifier, the verifier can only
+// read it from a file or fetch it again
+func updateVerifier(signature []byte) (*selfupdate.Verifier, error) {
+	sigFile, err := os.CreateTemp("", "ftb-update-*.minisig")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(sigFile.Name())
+	_, err = sigFile.Write(signature)
+	if closeErr := sigFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := selfupdate.NewVerifier()
+	if err = verifier.LoadFromFile(sigFile.Name(), UpdatePublicKey); err != nil {
+		return nil, err
+	}
+	return verifier, nil
+}
+
+func getUpdateFile(url string) ([]byte, error) {
+	resp, err := HTTPClient().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"aead.dev/minisign"
+)
+
+func TestApplyUpdate(t *testing.T) {
+	publicKey, privateKey, err := minisign.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := minisign.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := []byte("new installer")
+	tampered := []byte("tampered installer")
+
+	sign := func(key minisign.PrivateKey, b []byte, comment string) []byte {
+		return minisign.SignWithComments(key, b, comment, "")
+	}
+
+	// A stand-in for the release downloads
+	files := map[string][]byte{
+		"/v2/installer":                     release,
+		"/v2/installer.minisig":             sign(privateKey, release, "installer v2"),
+		"/tampered/installer":               tampered,
+		"/tampered/installer.minisig":       sign(privateKey, release, "installer v2"),
+		"/other-key/installer":              release,
+		"/other-key/installer.minisig":      sign(otherKey, release, "installer v2"),
+		"/unsigned/installer":               release,
+		"/old-release/installer":            release,
+		"/old-release/installer.minisig":    sign(privateKey, release, "installer v1"),
+		"/other-platform/installer":         release,
+		"/other-platform/installer.minisig": sign(privateKey, release, "installer.exe v2"),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	key, err := publicKey.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := UpdatePublicKey
+	UpdatePublicKey = string(key)
+	defer func() {
+		UpdatePublicKey = oldKey
+	}()
+
+	target := filepath.Join(t.TempDir(), "installer")
+	writeTarget := func() {
+		if err := os.WriteFile(target, []byte("old installer"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{"/tampered", "/other-key", "/unsigned", "/old-release", "/other-platform"} {
+		writeTarget()
+		if err = ApplyUpdate(srv.URL+path+"/installer", "installer", "v2", target); err == nil {
+			t.Errorf("%s: update was applied", path)
+		}
+		if b, _ := os.ReadFile(target); string(b) != "old installer" {
+			t.Errorf("%s: installer was replaced with %q", path, b)
+		}
+	}
+
+	writeTarget()
+	if err = ApplyUpdate(srv.URL+"/v2/installer", "installer", "v2", target); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(target); string(b) != string(release) {
+		t.Errorf("installer is %q after the update", b)
+	}
+
+	// The verifier selfupdate is given checks the same signature
+	verifier, err := updateVerifier(files["/v2/installer.minisig"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = verifier.Verify(release); err != nil {
+		t.Errorf("verifier rejected the release: %s", err)
+	}
+	if err = verifier.Verify(tampered); err == nil {
+		t.Error("verifier accepted a tampered installer")
+	}
+
+	// Builds without a key never update
+	UpdatePublicKey = ""
+	if err = ApplyUpdate(srv.URL+"/v2/installer", "installer", "v2", target); err == nil {
+		t.Error("update was applied without a public key")
+	}
+}
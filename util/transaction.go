@@ -0,0 +1,211 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pterm/pterm"
+)
+
+const (
+	StagingDirName  = ".ftb-staging"
+	BackupDirName   = ".ftb-backup"
+	backupFilesDir  = "files"
+	backupAddedName = "added.json"
+)
+
+// UpdateTransaction stages the files of a modpack update so nothing in the install directory is touched until
+// every download has succeeded, the files it replaces are kept in a backup so the update can be rolled back
+type UpdateTransaction struct {
+	InstallDir string
+	StagingDir string
+	BackupDir  string
+}
+
+// NewUpdateTransaction prepares an update of installDir. A staging directory left by a failed update is
+// reused so any partial downloads in it can be resumed.
+func NewUpdateTransaction(installDir string) (*UpdateTransaction, error) {
+	t := &UpdateTransaction{
+		InstallDir: installDir,
+		StagingDir: filepath.Join(installDir, StagingDirName),
+		BackupDir:  filepath.Join(installDir, BackupDirName),
+	}
+	if err := os.MkdirAll(t.StagingDir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create staging directory: %s", err.Error())
+	}
+	return t, nil
+}
+
+// movedFile is a file moved by Commit, kept so a failed commit can be undone
+type movedFile struct {
+	from string
+	to   string
+}
+
+// Commit swaps the staged files into the install directory. Files in replaced (and any existing file a
+// staged file overwrites) are moved into the backup along with the previous manifest.
+func (t *UpdateTransaction) Commit(staged []structs.File, replaced []structs.File, previous structs.Manifest) (err error) {
+	// Only the last update can be rolled back
+	if err = os.RemoveAll(t.BackupDir); err != nil {
+		return fmt.Errorf("unable to remove old backup: %s", err.Error())
+	}
+	if err = os.MkdirAll(filepath.Join(t.BackupDir, backupFilesDir), 0755); err != nil {
+		return fmt.Errorf("unable to create backup directory: %s", err.Error())
+	}
+	if err = WriteManifest(t.BackupDir, previous); err != nil {
+		return err
+	}
+
+	var moved []movedFile
+	var added []structs.File
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Put everything back the way it was, in reverse order
+		for i := len(moved) - 1; i >= 0; i-- {
+			if undoErr := os.Rename(moved[i].to, moved[i].from); undoErr != nil {
+				pterm.Error.Printfln("Unable to restore %s: %s", moved[i].from, undoErr.Error())
+			}
+		}
+	}()
+
+	backup := func(f structs.File) error {
+		src, err := SafeJoin(t.InstallDir, f.Path, f.Name)
+		if err != nil {
+			return err
+		}
+		if exists, _ := PathExists(src); !exists {
+			return nil
+		}
+		dst, err := SafeJoin(filepath.Join(t.BackupDir, backupFilesDir), f.Path, f.Name)
+		if err != nil {
+			return err
+		}
+		if exists, _ := PathExists(dst); exists {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return fmt.Errorf("unable to back up %s: %s", src, err.Error())
+		}
+		moved = append(moved, movedFile{from: src, to: dst})
+		return nil
+	}
+
+	for _, f := range replaced {
+		if err = backup(f); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range staged {
+		var dst, src string
+		if dst, err = SafeJoin(t.InstallDir, f.Path, f.Name); err != nil {
+			return err
+		}
+		if src, err = SafeJoin(t.StagingDir, f.Path, f.Name); err != nil {
+			return err
+		}
+		exists, _ := PathExists(dst)
+		if exists {
+			if err = backup(f); err != nil {
+				return err
+			}
+		} else {
+			added = append(added, f)
+		}
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err = os.Rename(src, dst); err != nil {
+			return fmt.Errorf("unable to move %s into place: %s", dst, err.Error())
+		}
+		moved = append(moved, movedFile{from: src, to: dst})
+	}
+
+	addedJson, err := json.MarshalIndent(added, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filepath.Join(t.BackupDir, backupAddedName), addedJson, 0644); err != nil {
+		return err
+	}
+
+	if removeErr := os.RemoveAll(t.StagingDir); removeErr != nil {
+		pterm.Warning.Printfln("Unable to remove staging directory: %s", removeErr.Error())
+	}
+	return nil
+}
+
+// HasBackup reports if installDir has an update that can be rolled back
+func HasBackup(installDir string) (bool, error) {
+	return PathExists(filepath.Join(installDir, BackupDirName, ManifestName))
+}
+
+// Rollback restores the files and manifest from before the last update, returning the restored manifest
+func Rollback(installDir string) (structs.Manifest, error) {
+	backupDir := filepath.Join(installDir, BackupDirName)
+	previous, err := ReadManifest(backupDir)
+	if err != nil {
+		return structs.Manifest{}, fmt.Errorf("no update to roll back: %s", err.Error())
+	}
+
+	var added []structs.File
+	addedJson, err := os.ReadFile(filepath.Join(backupDir, backupAddedName))
+	if err != nil {
+		return structs.Manifest{}, err
+	}
+	if err = json.Unmarshal(addedJson, &added); err != nil {
+		return structs.Manifest{}, err
+	}
+
+	for _, f := range added {
+		path, err := SafeJoin(installDir, f.Path, f.Name)
+		if err != nil {
+			return structs.Manifest{}, err
+		}
+		err = os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return structs.Manifest{}, err
+		}
+	}
+
+	filesDir := filepath.Join(backupDir, backupFilesDir)
+	err = filepath.WalkDir(filesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(filesDir, path)
+		if err != nil {
+			return err
+		}
+		dst, err := SafeJoin(installDir, relPath)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		pterm.Debug.Printfln("Restoring %s", relPath)
+		return os.Rename(path, dst)
+	})
+	if err != nil {
+		return structs.Manifest{}, fmt.Errorf("unable to restore files: %s", err.Error())
+	}
+
+	if err = WriteManifest(installDir, previous); err != nil {
+		return structs.Manifest{}, err
+	}
+	if err = os.RemoveAll(backupDir); err != nil {
+		pterm.Warning.Printfln("Unable to remove backup directory: %s", err.Error())
+	}
+	return previous, nil
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"ftb-server-downloader/structs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateCommitAndRollback(t *testing.T) {
+	installDir := t.TempDir()
+	write := func(dir, name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(installDir, name))
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+
+	previous := structs.Manifest{Name: "pack", VersionName: "1.0.0", VersionId: 1}
+	write(installDir, "mods/changed.jar", "old")
+	write(installDir, "mods/removed.jar", "removed")
+	write(installDir, "mods/unchanged.jar", "unchanged")
+	if err := WriteManifest(installDir, previous); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := NewUpdateTransaction(installDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(tx.StagingDir, "mods/changed.jar", "new")
+	write(tx.StagingDir, "mods/added.jar", "added")
+
+	changed := structs.File{Path: "mods", Name: "changed.jar"}
+	added := structs.File{Path: "mods", Name: "added.jar"}
+	removed := structs.File{Path: "mods", Name: "removed.jar"}
+	if err = tx.Commit([]structs.File{changed, added}, []structs.File{removed, changed}, previous); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := read("mods/changed.jar"); got != "new" {
+		t.Errorf("changed.jar = %q after commit, want %q", got, "new")
+	}
+	if got := read("mods/added.jar"); got != "added" {
+		t.Errorf("added.jar = %q after commit, want %q", got, "added")
+	}
+	if got := read("mods/removed.jar"); got != "" {
+		t.Errorf("removed.jar should not exist after commit")
+	}
+	if exists, _ := PathExists(tx.StagingDir); exists {
+		t.Errorf("staging directory should be removed after commit")
+	}
+
+	restored, err := Rollback(installDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.VersionId != previous.VersionId {
+		t.Errorf("restored version %d, want %d", restored.VersionId, previous.VersionId)
+	}
+	for name, want := range map[string]string{
+		"mods/changed.jar":   "old",
+		"mods/removed.jar":   "removed",
+		"mods/unchanged.jar": "unchanged",
+		"mods/added.jar":     "",
+	} {
+		if got := read(name); got != want {
+			t.Errorf("%s = %q after rollback, want %q", name, got, want)
+		}
+	}
+	if hasBackup, _ := HasBackup(installDir); hasBackup {
+		t.Errorf("backup should be removed after rollback")
+	}
+}
@@ -2,6 +2,8 @@ package util
 
 import (
 	"archive/zip"
+	"context"
+	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/json"
@@ -11,7 +13,6 @@ import (
 	"io"
 	"io/fs"
 	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -22,13 +23,11 @@ import (
 	"time"
 	"unicode"
 
-	semVer "github.com/hashicorp/go-version"
 	"github.com/pterm/pterm"
 )
 
 const (
-	ManifestName   = ".manifest.json"
-	adoptiumApiUrl = "https://api.adoptium.net"
+	ManifestName = ".manifest.json"
 )
 
 var (
@@ -66,7 +65,7 @@ func ParseInstallerName(filename string) (int, int, error) {
 	return pId, vId, nil
 }
 
-func makeRequest(method, url string, requestHeaders map[string][]string) (*http.Response, error) {
+func makeRequest(method, url string, requestHeaders map[string][]string, body io.Reader) (*http.Response, error) {
 	headers := map[string][]string{}
 	for k, v := range requestHeaders {
 		headers[k] = v
@@ -75,19 +74,35 @@ func makeRequest(method, url string, requestHeaders map[string][]string) (*http.
 	if ApiKey != "public" && strings.Contains(url, "api.feed-the-beast.com") {
 		headers["Authorization"] = []string{fmt.Sprintf("Bearer %s", ApiKey)}
 	}
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header = headers
 
-	return client.Do(req)
+	return HTTPClient().Do(req)
 }
 
 func DoGet(url string) (*http.Response, error) {
-	headers := map[string][]string{}
-	resp, err := makeRequest("GET", url, headers)
+	return DoGetWithHeaders(url, map[string][]string{})
+}
+
+// DoGetWithHeaders same as DoGet but allows extra request headers, e.g. provider API keys
+func DoGetWithHeaders(url string, headers map[string][]string) (*http.Response, error) {
+	resp, err := makeRequest("GET", url, headers, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(fmt.Sprintf("Error: %d\n%s", resp.StatusCode, b))
+	}
+	return resp, nil
+}
+
+func DoPost(url string, headers map[string][]string, body io.Reader) (*http.Response, error) {
+	resp, err := makeRequest("POST", url, headers, body)
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +116,7 @@ func DoGet(url string) (*http.Response, error) {
 
 func DoHead(url string) (*http.Response, error) {
 	headers := map[string][]string{}
-	resp, err := makeRequest("HEAD", url, headers)
+	resp, err := makeRequest("HEAD", url, headers, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -207,154 +222,24 @@ func PathExists(path string) (bool, error) {
 	return false, err
 }
 
-func OsJavaExists() bool {
-	path, err := exec.LookPath("java")
-	pterm.Debug.Printfln("Looking for java in %s", path)
-	if err != nil {
-		return false
-	}
-	return true
-}
-
-func GetJava(version string) (structs.File, error) {
-	adoptiumUrl, err := makeAdoptiumUrl(version)
-	if err != nil {
-		return structs.File{}, err
-	}
-
-	get, err := DoGet(adoptiumUrl)
-	if err != nil {
-		return structs.File{}, err
-	}
-	defer get.Body.Close()
-
-	var adoptium structs.Adoptium
-
-	err = json.NewDecoder(get.Body).Decode(&adoptium)
-	if err != nil {
-		return structs.File{}, err
-	}
-
-	var fileExt string
-	if strings.HasSuffix(adoptium[0].Binaries[0].Package.Name, ".zip") {
-		fileExt = ".zip"
-	} else if strings.HasSuffix(adoptium[0].Binaries[0].Package.Name, ".tar.gz") {
-		fileExt = ".tar.gz"
-	} else {
-		fileExt = "" // shrug
-	}
-
-	return structs.File{
-		Name:     "jre" + fileExt,
-		Path:     "",
-		Url:      adoptium[0].Binaries[0].Package.Link,
-		Hash:     adoptium[0].Binaries[0].Package.Checksum,
-		HashType: "sha256",
-	}, nil
+func GetJavaPath(version string) (string, error) {
+	return javaBinPath(filepath.Join("jre", version))
 }
 
-func GetJavaPath(version string) (string, error) {
+// javaBinPath is where the java binary is in a JRE extracted to dir by ExtractJava
+func javaBinPath(dir string) (string, error) {
 	switch runtime.GOOS {
 	case "windows":
-		return filepath.Join("jre", version, "bin", "java.exe"), nil
+		return filepath.Join(dir, "bin", "java.exe"), nil
 	case "darwin":
-		return filepath.Join("jre", version, "Contents", "Home", "bin", "java"), nil
+		return filepath.Join(dir, "Contents", "Home", "bin", "java"), nil
 	case "linux":
-		return filepath.Join("jre", version, "bin", "java"), nil
+		return filepath.Join(dir, "bin", "java"), nil
 	default:
 		return "", errors.New("unsupported platform")
 	}
 }
 
-func makeAdoptiumUrl(version string) (string, error) {
-	parsedUrl, err := url.Parse(adoptiumApiUrl + "/v3/assets/version/" + version)
-	if err != nil {
-		return "", err
-	}
-
-	q := parsedUrl.Query()
-	q.Add("heap_size", "normal")
-	q.Add("image_type", "jre")
-	q.Add("page", "0")
-	q.Add("page_size", "10")
-	q.Add("project", "jdk")
-	q.Add("release_type", "ga")
-	q.Add("semver", "false")
-	q.Add("sort_method", "DEFAULT")
-	q.Add("sort_order", "DESC")
-	q.Add("vendor", "eclipse")
-	if runtime.GOOS == "windows" {
-		q.Add("os", "windows")
-	}
-	if runtime.GOOS == "darwin" {
-		q.Add("os", "mac")
-	}
-	if runtime.GOOS == "linux" {
-		if _, err := os.Stat("/etc/alpine-release"); !os.IsNotExist(err) {
-			q.Add("os", "alpine-linux")
-		} else {
-			q.Add("os", "linux")
-		}
-	}
-
-	arch, err := validJavaArch(version)
-	if err != nil {
-		return "", err
-	}
-	q.Add("architecture", arch)
-
-	parsedUrl.RawQuery = q.Encode()
-
-	return parsedUrl.String(), nil
-}
-
-func validJavaArch(version string) (string, error) {
-	targetVersion, err := semVer.NewVersion(version)
-	if err != nil {
-		return "", err
-	}
-	switch runtime.GOOS {
-	case "darwin":
-		if runtime.GOARCH == "arm64" {
-			limit, err := semVer.NewVersion("11.0.0")
-			if err != nil {
-				return "", err
-			}
-			if targetVersion.LessThan(limit) {
-				return "x64", nil
-			}
-			return "aarch64", nil
-		}
-		if runtime.GOARCH == "amd64" {
-			return "x64", nil
-		}
-		if runtime.GOARCH == "386" {
-			return "x86", nil
-		}
-	case "windows":
-		if runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64" {
-			return "x64", nil
-		}
-		if runtime.GOARCH == "386" || runtime.GOARCH == "arm" {
-			return "x86", nil
-		}
-	case "linux":
-		if runtime.GOARCH == "amd64" {
-			return "x64", nil
-		}
-		if runtime.GOARCH == "386" {
-			return "x86", nil
-		}
-		if runtime.GOARCH == "arm64" {
-			return "aarch64", nil
-		}
-		if runtime.GOARCH == "arm" {
-			return "arm", nil
-		}
-	}
-	return "", errors.New("unsupported architecture, please contact FTB support")
-}
-
 func FileHash(path string, hash string) (string, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -375,6 +260,12 @@ func FileHash(path string, hash string) (string, error) {
 			return "", err
 		}
 		return fmt.Sprintf("%x", h.Sum(nil)), nil
+	case "md5":
+		h := md5.New()
+		if _, err = io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", h.Sum(nil)), nil
 	default:
 		return "", errors.New("unsupported hash type")
 	}
@@ -525,13 +416,20 @@ func (cw *CustomWriter) Write(p []byte) (n int, err error) {
 	return cw.writer.Write(filtered)
 }
 
-// FailedDownloadHandler handles the download retry logic
+// FailedDownloadHandler handles the download retry logic, the backoff is cut short if ctx is cancelled
 // return format is (attempts, mirror, error)
-func FailedDownloadHandler(attempts, m int, file structs.File, mirror string, mirrors []string) (bool, bool, error) {
+func FailedDownloadHandler(ctx context.Context, attempts, m int, file structs.File, mirror string, mirrors []string) (bool, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, false, err
+	}
 	if attempts < 2 {
 		sleepTime := BackoffTimes[attempts]
 		pterm.Warning.Printfln("Failed to download file %s from %s, retrying in %s", file.Name, mirror, sleepTime.String())
-		time.Sleep(sleepTime)
+		select {
+		case <-time.After(sleepTime):
+		case <-ctx.Done():
+			return false, false, ctx.Err()
+		}
 		return true, false, nil
 	} else if attempts >= 2 && m < len(mirrors)-1 { // TODO: Validate this
 		pterm.Warning.Printfln("Failed to download file %s from %s, trying next mirror", file.Name, mirror)
@@ -0,0 +1,115 @@
+package util
+
+import (
+	"errors"
+	"ftb-server-downloader/structs"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// VerifyReport is the drift between an install and its manifest, paths are slash separated and relative
+// to the install directory
+type VerifyReport struct {
+	Checked  int
+	Missing  []structs.File
+	Modified []structs.File
+	// Extra are untracked files found in the folders the pack installs files into
+	Extra []string
+}
+
+// HasDrift reports if the install no longer matches the manifest
+func (r VerifyReport) HasDrift() bool {
+	return len(r.Missing) > 0 || len(r.Modified) > 0 || len(r.Extra) > 0
+}
+
+// Invalid returns the missing and modified files, the files a repair would download again
+func (r VerifyReport) Invalid() []structs.File {
+	return append(append([]structs.File{}, r.Missing...), r.Modified...)
+}
+
+// VerifyInstall checks the files in installDir against the manifest without going online. Every file in the
+// manifest is hashed, and the folders holding those files are checked for files the manifest doesn't know
+// about. The install root is not checked for extra files as that's where the server keeps its own files, and
+// the .new, .orig and .part files the installer leaves next to a tracked file aren't extra either.
+func VerifyInstall(installDir string, manifest structs.Manifest) (VerifyReport, error) {
+	var report VerifyReport
+	tracked := make(map[string]struct{})
+	managedDirs := make(map[string]struct{})
+
+	for _, f := range manifest.Files {
+		relPath := filePath(f)
+		tracked[relPath] = struct{}{}
+		if dir := path.Dir(relPath); dir != "." {
+			managedDirs[dir] = struct{}{}
+		}
+
+		report.Checked++
+		fullPath := filepath.Join(installDir, filepath.FromSlash(relPath))
+		if f.Hash == "" || f.HashType == "" {
+			if exists, err := PathExists(fullPath); err != nil {
+				return report, err
+			} else if !exists {
+				report.Missing = append(report.Missing, f)
+			}
+			continue
+		}
+
+		hash, err := FileHash(fullPath, f.HashType)
+		if errors.Is(err, fs.ErrNotExist) {
+			report.Missing = append(report.Missing, f)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		if !strings.EqualFold(hash, f.Hash) {
+			report.Modified = append(report.Modified, f)
+		}
+	}
+
+	for dir := range managedDirs {
+		entries, err := os.ReadDir(filepath.Join(installDir, filepath.FromSlash(dir)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			relPath := path.Join(dir, e.Name())
+			if _, ok := tracked[relPath]; !ok && !isSideFile(relPath, tracked) {
+				report.Extra = append(report.Extra, relPath)
+			}
+		}
+	}
+	sort.Strings(report.Extra)
+
+	return report, nil
+}
+
+// sideFileSuffixes are the files the installer leaves next to a pack file, the partial downloads and the
+// versions of a locally edited file an update didn't put in place
+var sideFileSuffixes = []string{partSuffix + validatorSuffix, partSuffix, newSuffix, origSuffix}
+
+// isSideFile reports if relPath is one of the installer's own files for a tracked file
+func isSideFile(relPath string, tracked map[string]struct{}) bool {
+	for _, suffix := range sideFileSuffixes {
+		if base, ok := strings.CutSuffix(relPath, suffix); ok {
+			_, isTracked := tracked[base]
+			return isTracked
+		}
+	}
+	return false
+}
+
+// filePath returns the slash separated path of a manifest file relative to the install directory
+func filePath(f structs.File) string {
+	return path.Join(filepath.ToSlash(f.Path), f.Name)
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"ftb-server-downloader/structs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyInstall(t *testing.T) {
+	installDir := t.TempDir()
+	write := func(name, content string) {
+		p := filepath.Join(installDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sha := func(content string) string {
+		return fmt.Sprintf("%x", sha1.Sum([]byte(content)))
+	}
+
+	manifest := structs.Manifest{Files: []structs.File{
+		{Name: "ok.jar", Path: "mods", Hash: sha("ok"), HashType: "sha1"},
+		{Name: "changed.jar", Path: "mods", Hash: sha("original"), HashType: "sha1"},
+		{Name: "missing.jar", Path: "mods", Hash: sha("missing"), HashType: "sha1"},
+		{Name: "server.properties", Path: "", Hash: sha("props"), HashType: "sha1"},
+		{Name: "unhashed.toml", Path: "config/pack"},
+	}}
+	write("mods/ok.jar", "ok")
+	write("mods/changed.jar", "tampered")
+	write("mods/extra.jar", "extra")
+	write("server.properties", "props")
+	write("config/pack/unhashed.toml", "anything")
+	write("config/pack/untracked.toml", "untracked")
+	// What an update or an interrupted download leaves next to a pack file isn't drift
+	write("config/pack/unhashed.toml.new", "update")
+	write("config/pack/unhashed.toml.orig", "original")
+	write("mods/missing.jar.part", "miss")
+	write("mods/missing.jar.part.validator", "\"etag\"")
+	write("mods/extra.jar.new", "extra")
+	// Files in the install root aren't managed by the pack
+	write("eula.txt", "eula=true")
+
+	report, err := VerifyInstall(installDir, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(files []structs.File) []string {
+		var out []string
+		for _, f := range files {
+			out = append(out, filePath(f))
+		}
+		return out
+	}
+	if report.Checked != 5 {
+		t.Errorf("Checked = %d, want 5", report.Checked)
+	}
+	if got, want := names(report.Missing), []string{"mods/missing.jar"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Missing = %v, want %v", got, want)
+	}
+	if got, want := names(report.Modified), []string{"mods/changed.jar"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Modified = %v, want %v", got, want)
+	}
+	if want := []string{"config/pack/untracked.toml", "mods/extra.jar", "mods/extra.jar.new"}; !reflect.DeepEqual(report.Extra, want) {
+		t.Errorf("Extra = %v, want %v", report.Extra, want)
+	}
+	if !report.HasDrift() {
+		t.Errorf("HasDrift() = false, want true")
+	}
+}